@@ -0,0 +1,151 @@
+package rbtree
+
+// An associative operation with an identity, used to summarize the items in
+// each subtree of an aggregated tree. See NewAggregated.
+type monoid struct {
+	value    func(Item) interface{}
+	combine  func(a, b interface{}) interface{}
+	identity interface{}
+
+	// The weight function of a tree created by NewWeighted, or nil.
+	weight func(Item) float64
+}
+
+// The summary of the items in the subtree rooted at a node of an aggregated
+// tree. Nodes of other trees have no augment.
+type augment struct {
+	value  interface{}
+	monoid *monoid
+}
+
+// Returns the aggregate of the subtree rooted at n, which may be nilChild.
+func (m *monoid) of(n *node) interface{} {
+	if n == nilChild {
+		return m.identity
+	}
+
+	return n.aug.value
+}
+
+// Recomputes the aggregate of the subtree rooted at n from its item and its
+// children, if the tree is aggregated. The children must be up to date.
+func (n *node) updateAggregate() {
+	if n.aug == nil {
+		return
+	}
+
+	m := n.aug.monoid
+	n.aug.value = m.combine(m.combine(m.of(n.left), m.value(n.item)), m.of(n.right))
+}
+
+// Recomputes the aggregates of n and each of its ancestors, after the item of n
+// or one of its children has changed.
+func updateAggregatesFrom(n *node) {
+	if n == nil || n.aug == nil {
+		return
+	}
+
+	for ; n != nil; n = n.Parent() {
+		n.updateAggregate()
+	}
+}
+
+// Makes m the aggregate maintained by the tree, recomputing the aggregate of
+// every node. If m is nil, the nodes no longer carry an aggregate.
+func (t *tree) setMonoid(m *monoid) {
+	t.monoid = m
+	if !t.Empty() {
+		setSubtreeMonoid(t.root, m)
+	}
+}
+
+func setSubtreeMonoid(n *node, m *monoid) {
+	if n == nilChild {
+		return
+	}
+
+	setSubtreeMonoid(n.left, m)
+	setSubtreeMonoid(n.right, m)
+	n.aug = nil
+	if m != nil {
+		n.aug = &augment{monoid: m}
+		n.updateAggregate()
+	}
+}
+
+// Returns the aggregate of the items of the subtree rooted at n whose in-order
+// indices within the subtree lie in [lo, hi). Only the subtrees along the paths
+// to the two ends of the range are visited.
+func (m *monoid) rangeOf(n *node, lo, hi int) interface{} {
+	if n == nilChild || lo >= hi || hi <= 0 || lo >= n.size {
+		return m.identity
+	}
+
+	if lo <= 0 && hi >= n.size {
+		return n.aug.value
+	}
+
+	left := n.left.size
+	result := m.rangeOf(n.left, lo, hi)
+	if lo <= left && left < hi {
+		result = m.combine(result, m.value(n.item))
+	}
+
+	return m.combine(result, m.rangeOf(n.right, lo-left-1, hi-left-1))
+}
+
+// Returns an empty tree which maintains, in every subtree, the aggregate of
+// the items it contains. The aggregate is computed by applying value to each
+// item and combining the results in ascending order of the items with
+// combine, which must be associative and have identity as its identity
+// element. For example, passing
+//
+//	func(item Item) int { return int(item.(Int)) }
+//	func(a, b int) int { return a + b }
+//	0
+//
+// maintains subtree sums. RangeAggregate then summarizes any range of the tree
+// in O(log n) time.
+//
+// Every modification of an aggregated tree calls value and combine O(log n)
+// times. Clone, Split, Merge and decoding preserve the aggregate; trees built
+// from other trees, such as by SetUnion, do not.
+func NewAggregated[A any](value func(Item) A, combine func(a, b A) A, identity A) Tree {
+	return Tree{inner: tree{monoid: &monoid{
+		value:    func(item Item) interface{} { return value(item) },
+		combine:  func(a, b interface{}) interface{} { return combine(a.(A), b.(A)) },
+		identity: identity,
+	}}}
+}
+
+// Returns an empty tree which maintains the sum of the weights of the items in
+// every subtree, which KeyAtCumulativeWeight descends to find an item by its
+// cumulative weight in O(log n) time. This is otherwise the same as
+// NewAggregated(weight, func(a, b float64) float64 { return a + b }, 0).
+func NewWeighted(weight func(Item) float64) Tree {
+	t := NewAggregated(weight, func(a, b float64) float64 { return a + b }, 0)
+	t.inner.monoid.weight = weight
+	return t
+}
+
+// Returns the aggregate of the items in the half-open range [begin, end) of a
+// tree created by NewAggregated, combined in ascending order. The result has
+// the type of the aggregates passed to NewAggregated. begin and end must come
+// from this tree, and begin must not be after end. RangeAggregate panics if
+// the tree is not aggregated.
+//
+// Runs in O(log n) time.
+func (t Tree) RangeAggregate(begin, end Iterator) interface{} {
+	m := t.inner.monoid
+	if m == nil {
+		panic("rbtree: RangeAggregate of a tree without aggregates")
+	}
+
+	lo, hi := begin.index(), end.index()
+	if begin.reversed {
+		// The range runs downwards from begin to just above end.
+		lo, hi = hi+1, lo+1
+	}
+
+	return m.rangeOf(t.inner.rootOrLeaf(), lo, hi)
+}
@@ -0,0 +1,72 @@
+package rbtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kind of modification made by an Op.
+type OpKind int
+
+const (
+	// Inserts an item which must not already be in the tree.
+	OpInsert OpKind = iota
+
+	// Deletes an item which must be in the tree.
+	OpDelete
+)
+
+// A single modification in a batch passed to Tree.Apply.
+type Op struct {
+	Kind OpKind
+	Item Item
+}
+
+var (
+	// Returned by Apply when an OpInsert finds an equivalent item.
+	ErrDuplicate = errors.New("duplicate item")
+
+	// Returned by Apply when an OpDelete finds no equivalent item.
+	ErrNotFound = errors.New("item not found")
+
+	// Returned by Apply when an operation has a nil item.
+	ErrNilItem = errors.New("nil item")
+)
+
+// Applies a batch of inserts and deletes to the tree in order. If any
+// operation fails, Apply returns an error wrapping ErrDuplicate or ErrNotFound
+// and the tree is left exactly as it was. Operations with a nil item are
+// rejected with ErrNilItem before any operation is applied.
+//
+// To provide this guarantee, the operations are applied to a copy of the tree
+// which replaces the original once they all succeed. Apply therefore takes
+// O(n + k log n) time and allocates a node for every item in the tree, so
+// prefer individual Insert and Delete calls when atomicity isn't needed.
+func (t *Tree) Apply(ops []Op) error {
+	defer t.check("Apply")
+
+	for i, op := range ops {
+		if op.Item == nil {
+			return fmt.Errorf("rbtree: operation %d: %w", i, ErrNilItem)
+		}
+	}
+
+	c := t.inner.clone()
+	for i, op := range ops {
+		switch op.Kind {
+		case OpInsert:
+			if !c.InsertUnique(op.Item) {
+				return fmt.Errorf("rbtree: operation %d: inserting %v: %w", i, op.Item, ErrDuplicate)
+			}
+		case OpDelete:
+			if _, ok := c.DeleteOK(op.Item); !ok {
+				return fmt.Errorf("rbtree: operation %d: deleting %v: %w", i, op.Item, ErrNotFound)
+			}
+		default:
+			return fmt.Errorf("rbtree: operation %d: unknown kind %d", i, op.Kind)
+		}
+	}
+
+	t.inner = c
+	return nil
+}
@@ -0,0 +1,137 @@
+package rbtree
+
+import "sync"
+
+// A Tree which can be shared by many goroutines. Methods which only read the
+// tree take a read lock, so they can run concurrently with each other, and
+// methods which modify it take the write lock.
+//
+// Iterators returned by a ConcurrentTree, like those of Find, First and
+// LowerBound, hold pointers to its nodes but not its lock. They are not safe to
+// use while another goroutine may modify the tree, since a concurrent Insert or
+// Delete can rebalance or remove the nodes they point to. Use SortedItems or
+// ForEach to iterate over a tree shared with writers.
+//
+// The zero value is an empty tree ready to use. A ConcurrentTree must not be
+// copied after first use.
+type ConcurrentTree struct {
+	mu   sync.RWMutex
+	tree Tree
+}
+
+// Returns an empty tree which is safe for concurrent use.
+func NewConcurrent() *ConcurrentTree {
+	return &ConcurrentTree{tree: New()}
+}
+
+// Same as Tree.Empty.
+func (t *ConcurrentTree) Empty() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Empty()
+}
+
+// Same as Tree.Size.
+func (t *ConcurrentTree) Size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Size()
+}
+
+// Same as Tree.Min.
+func (t *ConcurrentTree) Min() Item {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Min()
+}
+
+// Same as Tree.Max.
+func (t *ConcurrentTree) Max() Item {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Max()
+}
+
+// Same as Tree.FindItem.
+func (t *ConcurrentTree) FindItem(item Item) Item {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.FindItem(item)
+}
+
+// Same as Tree.Contains.
+func (t *ConcurrentTree) Contains(item Item) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Contains(item)
+}
+
+// Same as Tree.Find. The Iterator is only safe to use while no other goroutine
+// modifies the tree; use FindItem to look up an item shared with writers.
+func (t *ConcurrentTree) Find(item Item) (Iterator, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.Find(item)
+}
+
+// Same as Tree.First. The Iterator is only safe to use while no other
+// goroutine modifies the tree.
+func (t *ConcurrentTree) First() Iterator {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.First()
+}
+
+// Same as Tree.LowerBound. The Iterator is only safe to use while no other
+// goroutine modifies the tree.
+func (t *ConcurrentTree) LowerBound(target Item) Iterator {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.LowerBound(target)
+}
+
+// Same as Tree.Insert.
+func (t *ConcurrentTree) Insert(item Item) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tree.Insert(item)
+}
+
+// Same as Tree.InsertOrReplace.
+func (t *ConcurrentTree) InsertOrReplace(item Item) Item {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tree.InsertOrReplace(item)
+}
+
+// Same as Tree.Delete.
+func (t *ConcurrentTree) Delete(item Item) Item {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tree.Delete(item)
+}
+
+// Same as Tree.Clear.
+func (t *ConcurrentTree) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tree.Clear()
+}
+
+// Returns a snapshot of the items in the tree in ascending order, which can be
+// iterated over safely while other goroutines modify the tree.
+//
+// Runs in O(n) time.
+func (t *ConcurrentTree) SortedItems() []Item {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tree.ToSlice()
+}
+
+// Same as Tree.ForEach, but holds the read lock for the whole iteration. fn
+// must not modify the tree, or it will deadlock.
+func (t *ConcurrentTree) ForEach(fn func(Item) bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	t.tree.ForEach(fn)
+}
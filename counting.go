@@ -0,0 +1,271 @@
+package rbtree
+
+import "iter"
+
+// A multiset which stores each distinct item once, along with the number of
+// times it was inserted. This uses far fewer nodes than a MultiValuedTree when
+// there are many duplicates, but equivalent items are not stored separately:
+// only the first of a set of equivalent items is kept.
+type CountingTree struct {
+	inner tree
+
+	// The total number of items, counting duplicates.
+	size int
+}
+
+// An item stored in a CountingTree along with its multiplicity.
+type countedItem struct {
+	item  Item
+	count int
+}
+
+func (c countedItem) Less(than Item) bool {
+	return c.item.Less(than.(countedItem).item)
+}
+
+// Returns a fully initialized counting multiset.
+func NewCounting() CountingTree {
+	return CountingTree{}
+}
+
+// The aggregate of a tree created by NewCountingWithMode: the largest count in
+// each subtree.
+var maxCount = &monoid{
+	value: func(item Item) interface{} { return item.(countedItem).count },
+	combine: func(a, b interface{}) interface{} {
+		if a.(int) < b.(int) {
+			return b
+		}
+
+		return a
+	},
+	identity: 0,
+}
+
+// Returns a counting multiset which keeps track of the largest count in each of
+// its subtrees, so that Mode runs in O(log n) time instead of O(n). Every
+// modification does O(log n) more work to keep the counts up to date.
+func NewCountingWithMode() CountingTree {
+	return CountingTree{inner: tree{monoid: maxCount}}
+}
+
+// Returns true if the number of items in the tree is zero
+func (t CountingTree) Empty() bool {
+	return t.inner.Empty()
+}
+
+// Returns the number of items in the tree, counting duplicates. Runs in O(1)
+// time.
+func (t CountingTree) Size() int {
+	return t.size
+}
+
+// Returns the number of distinct items in the tree. Runs in O(1) time.
+func (t CountingTree) DistinctSize() int {
+	return t.inner.Size()
+}
+
+// Returns the minimum value in the tree or nil if the tree is empty.
+//
+// Runs in O(1) time.
+func (t CountingTree) Min() Item {
+	if t.Empty() {
+		return nil
+	}
+
+	return t.inner.Min().(countedItem).item
+}
+
+// Returns the maximum value in the tree or nil if the tree is empty.
+//
+// Runs in O(1) time.
+func (t CountingTree) Max() Item {
+	if t.Empty() {
+		return nil
+	}
+
+	return t.inner.Max().(countedItem).item
+}
+
+// Inserts an item into the tree, incrementing its count if an equivalent item
+// already exists.
+//
+// Runs in O(log n) time.
+func (t *CountingTree) Insert(item Item) {
+	if item == nil {
+		return
+	}
+
+	n, inserted := t.inner.insertUnique(countedItem{item, 1})
+	if !inserted {
+		c := n.item.(countedItem)
+		c.count += 1
+		n.item = c
+		updateAggregatesFrom(n)
+	}
+
+	t.size += 1
+}
+
+// Adjusts the count of an item by delta, inserting it if it is not already
+// present and delta is positive. If the count drops to zero or below, the item
+// is removed; counts are clamped at zero, so subtracting more copies than
+// exist simply removes them all. Size changes by the number of copies
+// actually added or removed.
+//
+// Runs in O(log n) time.
+func (t *CountingTree) Add(item Item, delta int) {
+	if item == nil || delta == 0 {
+		return
+	}
+
+	n := t.find(item)
+	if n == nil {
+		if delta > 0 {
+			t.inner.insertUnique(countedItem{item, delta})
+			t.size += delta
+		}
+
+		return
+	}
+
+	c := n.item.(countedItem)
+	if c.count+delta <= 0 {
+		t.inner.remove(n)
+		t.size -= c.count
+		return
+	}
+
+	c.count += delta
+	n.item = c
+	updateAggregatesFrom(n)
+	t.size += delta
+}
+
+// Returns the number of items equivalent to item in the tree.
+//
+// Runs in O(log n) time.
+func (t CountingTree) Count(item Item) int {
+	if n := t.find(item); n != nil {
+		return n.item.(countedItem).count
+	}
+
+	return 0
+}
+
+// Returns the most frequent item in the tree and its count, or nil and zero if
+// the tree is empty. If several items are equally frequent, the smallest is
+// returned.
+//
+// Runs in O(log n) time if the tree was created by NewCountingWithMode, or in
+// O(n) time otherwise.
+func (t CountingTree) Mode() (Item, int) {
+	if t.inner.monoid == maxCount {
+		return t.inner.mode()
+	}
+
+	var mode Item
+	max := 0
+	for item, count := range t.Counts() {
+		if count > max {
+			mode, max = item, count
+		}
+	}
+
+	return mode, max
+}
+
+// Decrements the count of an item equivalent to target, removing it once its
+// count reaches zero. Returns the item which was present in the tree, or nil if
+// none was found.
+//
+// Runs in O(log n) time.
+func (t *CountingTree) Delete(target Item) Item {
+	n := t.find(target)
+	if n == nil {
+		return nil
+	}
+
+	c := n.item.(countedItem)
+	if c.count == 1 {
+		t.inner.remove(n)
+	} else {
+		c.count -= 1
+		n.item = c
+		updateAggregatesFrom(n)
+	}
+
+	t.size -= 1
+	return c.item
+}
+
+// Removes all items from the tree.
+func (t *CountingTree) Clear() {
+	t.inner.Clear()
+	t.size = 0
+}
+
+// Returns a sequence of the items in the tree in order, with each item
+// repeated as many times as it was inserted.
+//
+// The tree must not be modified while the sequence is being iterated.
+func (t CountingTree) All() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		for item, count := range t.Counts() {
+			for i := 0; i < count; i++ {
+				if !yield(item) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Returns a sequence of the distinct items in the tree in order, along with
+// their counts.
+//
+// The tree must not be modified while the sequence is being iterated.
+func (t CountingTree) Counts() iter.Seq2[Item, int] {
+	return func(yield func(Item, int) bool) {
+		for n := t.inner.First().node; n != nil; n = successor(n) {
+			c := n.item.(countedItem)
+			if !yield(c.item, c.count) {
+				return
+			}
+		}
+	}
+}
+
+// Returns the node holding an item equivalent to target, or nil if none
+// exists.
+func (t CountingTree) find(target Item) *node {
+	if t.Empty() || target == nil {
+		return nil
+	}
+
+	if n, ord := get(t.inner.root, countedItem{item: target}); ord == equalTo {
+		return n
+	}
+
+	return nil
+}
+
+// Returns the most frequent item of a tree created by NewCountingWithMode, by
+// descending towards the leftmost node whose count is the largest in the tree.
+func (t tree) mode() (Item, int) {
+	if t.Empty() {
+		return nil, 0
+	}
+
+	max := t.root.aug.value.(int)
+	for n := t.root; ; {
+		switch {
+		case maxCount.of(n.left).(int) == max:
+			n = n.left
+		case n.item.(countedItem).count == max:
+			return n.item.(countedItem).item, max
+		default:
+			n = n.right
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package rbtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Applies the same random inserts and deletes to a CountingTree and a
+// MultiValuedTree and checks that they agree.
+func TestCountingTree(t *testing.T) {
+	rand.Seed(45)
+
+	counting := NewCounting()
+	multi := NewMultiValued()
+	for i := 0; i < 100000; i++ {
+		item := Int(rand.Intn(20))
+		if rand.Float64() < probabilityOfInsert(multi.Size()) {
+			counting.Insert(item)
+			multi.Insert(item)
+		} else if (counting.Delete(item) == nil) != (multi.Delete(item) == nil) {
+			t.Fatalf("Trees disagree about whether %v was present", item)
+		}
+
+		if i%100 == 0 {
+			checkCountingTree(t, counting, multi)
+		}
+	}
+
+	checkCountingTree(t, counting, multi)
+}
+
+func checkCountingTree(t *testing.T, counting CountingTree, multi MultiValuedTree) {
+	if counting.Size() != multi.Size() {
+		t.Fatalf("Size is %d, expected %d", counting.Size(), multi.Size())
+	}
+
+	if counting.Min() != multi.Min() || counting.Max() != multi.Max() {
+		t.Fatalf("Extremes are (%v, %v), expected (%v, %v)",
+			counting.Min(), counting.Max(), multi.Min(), multi.Max())
+	}
+
+	distinct := 0
+	it := multi.First()
+	for item := range counting.All() {
+		if !it.IsValid() || it.Item() != item {
+			t.Fatalf("Iteration yielded %v out of place", item)
+		}
+
+		if it == multi.LowerBound(item) {
+			distinct += 1
+
+			count := 0
+			for i, end := multi.LowerBound(item), multi.UpperBound(item); i != end; i.Next() {
+				count += 1
+			}
+
+			if counting.Count(item) != count {
+				t.Fatalf("Count(%v) is %d, expected %d", item, counting.Count(item), count)
+			}
+		}
+
+		it.Next()
+	}
+
+	if it.IsValid() {
+		t.Fatal("Iteration ended early")
+	}
+
+	if counting.DistinctSize() != distinct {
+		t.Fatalf("DistinctSize is %d, expected %d", counting.DistinctSize(), distinct)
+	}
+
+	checkTreeInvariants(t, counting.inner.root)
+}
+
+func TestCountingTreeAdd(t *testing.T) {
+	tree := NewCounting()
+
+	check := func(item Item, count, size, distinct int) {
+		if tree.Count(item) != count || tree.Size() != size || tree.DistinctSize() != distinct {
+			t.Fatalf("Expected Count(%v) = %d, Size = %d, DistinctSize = %d; got %d, %d, %d",
+				item, count, size, distinct, tree.Count(item), tree.Size(), tree.DistinctSize())
+		}
+	}
+
+	tree.Add(Int(1), 100)
+	check(Int(1), 100, 100, 1)
+
+	tree.Add(Int(2), -5)
+	check(Int(2), 0, 100, 1)
+
+	tree.Insert(Int(2))
+	tree.Add(Int(2), 9)
+	check(Int(2), 10, 110, 2)
+
+	tree.Add(Int(1), -99)
+	check(Int(1), 1, 11, 2)
+
+	tree.Add(Int(1), -1)
+	check(Int(1), 0, 10, 1)
+
+	tree.Add(Int(2), -50)
+	check(Int(2), 0, 0, 0)
+
+	if !tree.Empty() {
+		t.Fatal("Tree should be empty after subtracting every count")
+	}
+}
+
+func TestCountingTreeMode(t *testing.T) {
+	rand.Seed(46)
+
+	for _, tree := range []CountingTree{NewCounting(), NewCountingWithMode()} {
+		if item, count := tree.Mode(); item != nil || count != 0 {
+			t.Fatalf("Mode of an empty tree = (%v, %d)", item, count)
+		}
+
+		freq := make(map[int]int)
+		for i := 0; i < 10000; i++ {
+			item := rand.Intn(50)
+			switch r := rand.Float64(); {
+			case r < 0.6:
+				tree.Insert(Int(item))
+				freq[item] += 1
+			case r < 0.7:
+				tree.Add(Int(item), 3)
+				freq[item] += 3
+			case freq[item] > 0:
+				tree.Delete(Int(item))
+				freq[item] -= 1
+			}
+
+			// The expected mode is the smallest item with the highest frequency.
+			mode, max := -1, 0
+			for i, count := range freq {
+				if count > max || count == max && count > 0 && i < mode {
+					mode, max = i, count
+				}
+			}
+
+			got, count := tree.Mode()
+			if count != max || max > 0 && got != Int(mode) {
+				t.Fatalf("Mode = (%v, %d), expected (%d, %d)", got, count, mode, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package rbtree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Encodes the items of the tree as a sequence of integer keys, as returned by
+// toInt. Each key is written as the varint-encoded difference from the
+// previous key, so trees of dense or clustered integers encode very compactly.
+//
+// Runs in O(n) time.
+func (t Tree) MarshalDelta(toInt func(Item) int64) []byte {
+	var data []byte
+	var prev int64
+	for n := t.inner.First().node; n != nil; n = successor(n) {
+		key := toInt(n.item)
+		data = binary.AppendVarint(data, key-prev)
+		prev = key
+	}
+
+	return data
+}
+
+// Decodes a tree encoded by MarshalDelta, converting each key back into an
+// Item with fromInt. If the data contains equivalent items, only the first is
+// kept. If fromInt returns nil, UnmarshalDelta returns an error.
+//
+// Runs in O(n) time if the decoded items are sorted, as they are when produced
+// by MarshalDelta, or O(n log n) time otherwise.
+func UnmarshalDelta(data []byte, fromInt func(int64) Item) (Tree, error) {
+	var items []Item
+	var key int64
+	for len(data) > 0 {
+		delta, n := binary.Varint(data)
+		if n <= 0 {
+			return Tree{}, errors.New("rbtree: invalid delta encoding")
+		}
+
+		key += delta
+		item := fromInt(key)
+		if item == nil {
+			return Tree{}, fmt.Errorf("rbtree: key %d: decoded %w", key, ErrNilItem)
+		}
+
+		items = append(items, item)
+		data = data[n:]
+	}
+
+	return Tree{inner: buildDecoded(items)}, nil
+}
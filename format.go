@@ -0,0 +1,149 @@
+package rbtree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns a rendering of the structure of the tree, with one line per node
+// indented by its depth. Each line gives the side of its parent the node is
+// on (L or R), its color (B or R), and its item as formatted by fmt.
+func (t tree) String() string {
+	if t.Empty() {
+		return "(empty)\n"
+	}
+
+	var b strings.Builder
+	writeSubtree(&b, t.root, "", 0)
+	return b.String()
+}
+
+func writeSubtree(b *strings.Builder, n *node, side string, depth int) {
+	if n == nilChild {
+		return
+	}
+
+	color := "R"
+	if n.IsBlack() {
+		color = "B"
+	}
+
+	fmt.Fprintf(b, "%s%s%s %v\n", strings.Repeat("  ", depth), side, color, n.item)
+	writeSubtree(b, n.left, "L: ", depth+1)
+	writeSubtree(b, n.right, "R: ", depth+1)
+}
+
+// Returns a description of the tree in the Graphviz DOT language, with each
+// node filled with its color and labelled with its item as formatted by fmt.
+func (t tree) Dot() string {
+	var b strings.Builder
+	b.WriteString("digraph rbtree {\n")
+	b.WriteString("\tnode [style=filled, fontcolor=white];\n")
+	if !t.Empty() {
+		id := 0
+		writeDot(&b, t.root, &id)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Writes the subtree rooted at n, numbering its nodes from *id, and returns the
+// number of n.
+func writeDot(b *strings.Builder, n *node, id *int) int {
+	self := *id
+	*id += 1
+
+	color := "red"
+	if n.IsBlack() {
+		color = "black"
+	}
+
+	fmt.Fprintf(b, "\tn%d [label=%q, fillcolor=%s];\n", self, fmt.Sprint(n.item), color)
+	for i, child := range n.Children() {
+		if child == nilChild {
+			continue
+		}
+
+		fmt.Fprintf(b, "\tn%d -> n%d [label=%q];\n", self, writeDot(b, child, id), [...]string{"L", "R"}[i])
+	}
+
+	return self
+}
+
+// The order in which Walk visits the nodes of a tree.
+type TraversalOrder int
+
+const (
+	// Visits each node before its left subtree and then its right subtree.
+	PreOrder TraversalOrder = iota
+
+	// Visits each node between its left subtree and its right subtree, which
+	// visits the items in ascending order.
+	InOrder
+
+	// Visits each node after its left subtree and then its right subtree.
+	PostOrder
+)
+
+// Calls fn on every node of the tree in the given order, with the node's item,
+// whether it is black, and its depth, which is zero for the root. The leaves
+// are not visited.
+func (t tree) Walk(order TraversalOrder, fn func(item Item, black bool, depth int)) {
+	if !t.Empty() {
+		walk(t.root, order, fn, 0)
+	}
+}
+
+func walk(n *node, order TraversalOrder, fn func(item Item, black bool, depth int), depth int) {
+	if n == nilChild {
+		return
+	}
+
+	if order == PreOrder {
+		fn(n.item, n.IsBlack(), depth)
+	}
+
+	walk(n.left, order, fn, depth+1)
+	if order == InOrder {
+		fn(n.item, n.IsBlack(), depth)
+	}
+
+	walk(n.right, order, fn, depth+1)
+	if order == PostOrder {
+		fn(n.item, n.IsBlack(), depth)
+	}
+}
+
+// Returns a rendering of the structure of the tree for debugging, with one
+// line per node indented by its depth. Each line gives the side of its parent
+// the node is on (L or R), its color (B or R), and its item.
+//
+// Runs in O(n) time.
+func (t Tree) String() string {
+	return t.inner.String()
+}
+
+// Returns a description of the structure of the tree in the Graphviz DOT
+// language, which can be rendered with
+//
+//	dot -Tsvg tree.dot > tree.svg
+//
+// to visualize balancing bugs.
+//
+// Runs in O(n) time.
+func (t Tree) Dot() string {
+	return t.inner.Dot()
+}
+
+// Calls fn on every node of the tree in the given order, with the node's item,
+// whether it is black, and its depth, which is zero for the root. Unlike
+// ForEach, DebugWalk exposes the exact shape of the tree, so that it can be
+// recorded or serialized to reproduce balancing bugs. A PreOrder walk, for
+// instance, visits the nodes in the order they appear in String. The tree must
+// not be modified by fn.
+//
+// Runs in O(n) time.
+func (t Tree) DebugWalk(order TraversalOrder, fn func(item Item, black bool, depth int)) {
+	t.inner.Walk(order, fn)
+}
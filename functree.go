@@ -0,0 +1,114 @@
+package rbtree
+
+// A red-black tree whose values are unique and ordered by a comparison
+// function, for types which have no Less method and no natural < operator.
+//
+// The zero value has no comparison function and must not be used; create
+// FuncTrees with NewFunc.
+type FuncTree[T any] struct {
+	inner funcTree[T]
+}
+
+// Returns an empty tree ordered by cmp, which must return a negative number,
+// zero, or a positive number when a is less than, equal to, or greater than b,
+// like bytes.Compare. cmp must define a strict weak ordering on values of T.
+func NewFunc[T any](cmp func(a, b T) int) FuncTree[T] {
+	return FuncTree[T]{inner: funcTree[T]{cmp: cmp}}
+}
+
+// Returns true if the number of values in the tree is zero
+func (t FuncTree[T]) Empty() bool {
+	return t.inner.Empty()
+}
+
+// Returns the size of the tree. Runs in O(1) time.
+func (t FuncTree[T]) Size() int {
+	return t.inner.Size()
+}
+
+// Returns the minimum value in the tree, or false if the tree is empty.
+//
+// Runs in O(log n) time.
+func (t FuncTree[T]) Min() (v T, ok bool) {
+	if n := t.inner.first(); n != nil {
+		return n.value, true
+	}
+
+	return
+}
+
+// Returns the maximum value in the tree, or false if the tree is empty.
+//
+// Runs in O(log n) time.
+func (t FuncTree[T]) Max() (v T, ok bool) {
+	if n := t.inner.last(); n != nil {
+		return n.value, true
+	}
+
+	return
+}
+
+// Inserts a value into the tree if it is not already present. Returns true if
+// the value was inserted, or false if a duplicate was found.
+//
+// Runs in O(log n) time.
+func (t *FuncTree[T]) Insert(v T) bool {
+	return t.inner.insert(v)
+}
+
+// Deletes v from the tree, returning true if it was present. If it was not,
+// Delete returns false and does not modify the tree.
+//
+// Runs in O(log n) time.
+func (t *FuncTree[T]) Delete(v T) bool {
+	return t.inner.delete(v)
+}
+
+// Removes all values from the tree. Runs in O(1) time.
+func (t *FuncTree[T]) Clear() {
+	t.inner.clear()
+}
+
+// Searches the tree, returning an iterator to v if it was found, along with a
+// boolean indicating whether the search was successful.
+//
+// Runs in O(log n) time.
+func (t FuncTree[T]) Find(v T) (TypedIterator[T], bool) {
+	n := t.inner.find(v)
+	return TypedIterator[T]{node: n}, n != nil
+}
+
+// Returns an invalid iterator pointing one past the beginning/end of
+// the tree. (it != tree.End()) implies it.IsValid().
+func (t FuncTree[T]) End() TypedIterator[T] {
+	return TypedIterator[T]{}
+}
+
+// Returns an iterator pointing to the first value in the tree.
+//
+// Runs in O(log n) time.
+func (t FuncTree[T]) First() TypedIterator[T] {
+	return TypedIterator[T]{node: t.inner.first()}
+}
+
+// Returns an iterator pointing to the last value in the tree.
+//
+// Runs in O(log n) time.
+func (t FuncTree[T]) Last() TypedIterator[T] {
+	return TypedIterator[T]{node: t.inner.last()}
+}
+
+// Returns an iterator pointing to the smallest value greater than or equal to
+// target.
+//
+// Runs in O(log n) time.
+func (t FuncTree[T]) LowerBound(target T) TypedIterator[T] {
+	return TypedIterator[T]{node: t.inner.lowerBound(target)}
+}
+
+// Returns an iterator pointing to the smallest value greater than target.
+//
+// Runs in O(log n) time.
+func (t FuncTree[T]) UpperBound(target T) TypedIterator[T] {
+	return TypedIterator[T]{node: t.inner.upperBound(target)}
+}
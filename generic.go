@@ -0,0 +1,507 @@
+package rbtree
+
+// This file contains a generic version of the red-black tree in node.go and
+// tree.go, which stores values of any type directly in its nodes and orders
+// them with a three-way comparison function instead of an Item's Less method.
+// See node.go for diagrams of the balancing cases.
+
+// The generic counterpart of node.
+type gnode[T any] struct {
+	black       bool
+	parent      *gnode[T]
+	left, right *gnode[T]
+
+	value T
+}
+
+// Go has no generic package-level variables, so each funcTree allocates its own
+// leaf sentinel, the counterpart of nilChild. The sentinel is the only node
+// whose children are nil, which lets a node recognize a leaf without a
+// reference to its tree.
+func (n *gnode[T]) isLeaf() bool { return n.left == nil }
+
+func (n *gnode[T]) IsRoot() bool        { return n.parent == nil }
+func (n *gnode[T]) HasLeftChild() bool  { return !n.left.isLeaf() }
+func (n *gnode[T]) HasRightChild() bool { return !n.right.isLeaf() }
+func (n *gnode[T]) IsBlack() bool       { return n.black }
+func (n *gnode[T]) IsRed() bool         { return !n.black }
+func (n *gnode[T]) SetBlack()           { n.black = true }
+func (n *gnode[T]) SetRed()             { n.black = false }
+func (n *gnode[T]) CopyColorOf(o *gnode[T]) {
+	n.black = o.black
+}
+
+func (n *gnode[T]) IsLeftChildOf(p *gnode[T]) bool  { return p.left == n }
+func (n *gnode[T]) IsRightChildOf(p *gnode[T]) bool { return p.right == n }
+
+// Returns the minimum-valued node in the subtree rooted at n.
+func (n *gnode[T]) min() *gnode[T] {
+	for n.HasLeftChild() {
+		n = n.left
+	}
+
+	return n
+}
+
+// Returns the maximum-valued node in the subtree rooted at n.
+func (n *gnode[T]) max() *gnode[T] {
+	for n.HasRightChild() {
+		n = n.right
+	}
+
+	return n
+}
+
+// Returns the in-order predecessor of n, or nil if there is none.
+func (n *gnode[T]) predecessor() *gnode[T] {
+	if n.HasLeftChild() {
+		return n.left.max()
+	}
+
+	for p := n.parent; p != nil; n, p = p, p.parent {
+		if n.IsRightChildOf(p) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Returns the in-order successor of n, or nil if there is none.
+func (n *gnode[T]) successor() *gnode[T] {
+	if n.HasRightChild() {
+		return n.right.min()
+	}
+
+	for p := n.parent; p != nil; n, p = p, p.parent {
+		if n.IsLeftChildOf(p) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Same as rotateRightNoFixup.
+func (root *gnode[T]) rotateRightNoFixup() {
+	pivot := root.left
+
+	orphan := pivot.right
+	root.left = orphan
+	orphan.parent = root
+
+	pivot.parent = root.parent
+	pivot.right = root
+	root.parent = pivot
+}
+
+// Same as rotateLeftNoFixup.
+func (root *gnode[T]) rotateLeftNoFixup() {
+	pivot := root.right
+
+	orphan := pivot.left
+	root.right = orphan
+	orphan.parent = root
+
+	pivot.parent = root.parent
+	pivot.left = root
+	root.parent = pivot
+}
+
+// A red-black tree of values of type T ordered by cmp, which returns a negative
+// number, zero, or a positive number when a is less than, equal to, or greater
+// than b. Values are unique.
+type funcTree[T any] struct {
+	root *gnode[T]
+	leaf *gnode[T]
+	size int
+	cmp  func(a, b T) int
+}
+
+// Same as fixupAfterRotate.
+func (t *funcTree[T]) fixupAfterRotate(oldRoot *gnode[T]) {
+	newRoot := oldRoot.parent
+	parent := newRoot.parent
+	switch {
+	case parent == nil:
+		t.root = newRoot
+	case parent.left == oldRoot:
+		parent.left = newRoot
+	case parent.right == oldRoot:
+		parent.right = newRoot
+	}
+}
+
+// Same as balanceAfterInsert.
+func (t *funcTree[T]) balanceAfterInsert(x *gnode[T]) {
+	for {
+		// Case 1
+		if x.IsRoot() {
+			x.SetBlack()
+			t.root = x
+			return
+		}
+
+		parent := x.parent
+
+		// Case 2
+		if parent.IsBlack() {
+			return
+		}
+
+		gparent := parent.parent
+
+		if parent.IsLeftChildOf(gparent) {
+			// Case 3
+			uncle := gparent.right
+			if uncle.IsRed() {
+				parent.SetBlack()
+				uncle.SetBlack()
+				gparent.SetRed()
+				x = gparent
+				continue
+			}
+
+			// Case 4
+			if x.IsRightChildOf(parent) {
+				parent.rotateLeftNoFixup()
+				gparent.left = x
+				parent = x
+			}
+
+			// Case 5
+			parent.SetBlack()
+			gparent.SetRed()
+			gparent.rotateRightNoFixup()
+			t.fixupAfterRotate(gparent)
+			return
+		} else {
+			// Case 3
+			uncle := gparent.left
+			if uncle.IsRed() {
+				parent.SetBlack()
+				uncle.SetBlack()
+				gparent.SetRed()
+				x = gparent
+				continue
+			}
+
+			// Case 4
+			if x.IsLeftChildOf(parent) {
+				parent.rotateRightNoFixup()
+				gparent.right = x
+				parent = x
+			}
+
+			// Case 5
+			parent.SetBlack()
+			gparent.SetRed()
+			gparent.rotateLeftNoFixup()
+			t.fixupAfterRotate(gparent)
+			return
+		}
+	}
+}
+
+// Same as balanceAfterDelete.
+func (t *funcTree[T]) balanceAfterDelete(x *gnode[T]) {
+	for {
+		// Case 1
+		if x.IsRoot() {
+			t.root = x
+			return
+		}
+
+		parent := x.parent
+
+		if x.IsLeftChildOf(parent) {
+			sibling := parent.right
+
+			// Case 2
+			if sibling.IsRed() {
+				parent.SetRed()
+				sibling.SetBlack()
+				parent.rotateLeftNoFixup()
+				t.fixupAfterRotate(parent)
+				sibling = parent.right
+			}
+
+			// Case 3
+			leftNiece, rightNiece := sibling.left, sibling.right
+			if sibling.IsBlack() && leftNiece.IsBlack() && rightNiece.IsBlack() {
+				sibling.SetRed()
+				if parent.IsRed() {
+					parent.SetBlack()
+					return
+				} else {
+					x = parent
+					continue
+				}
+			}
+
+			// Case 4
+			if leftNiece.IsRed() && rightNiece.IsBlack() {
+				leftNiece.SetBlack()
+				sibling.SetRed()
+				sibling.rotateRightNoFixup()
+				parent.right = leftNiece
+				sibling, leftNiece, rightNiece = leftNiece, leftNiece.left, sibling
+			}
+
+			// Case 5
+			sibling.CopyColorOf(parent)
+			parent.SetBlack()
+			rightNiece.SetBlack()
+			parent.rotateLeftNoFixup()
+			t.fixupAfterRotate(parent)
+			return
+		} else {
+			sibling := parent.left
+
+			// Case 2
+			if sibling.IsRed() {
+				parent.SetRed()
+				sibling.SetBlack()
+				parent.rotateRightNoFixup()
+				t.fixupAfterRotate(parent)
+				sibling = parent.left
+			}
+
+			// Case 3
+			leftNiece, rightNiece := sibling.left, sibling.right
+			if sibling.IsBlack() && leftNiece.IsBlack() && rightNiece.IsBlack() {
+				sibling.SetRed()
+				if parent.IsRed() {
+					parent.SetBlack()
+					return
+				} else {
+					x = parent
+					continue
+				}
+			}
+
+			// Case 4
+			if leftNiece.IsBlack() && rightNiece.IsRed() {
+				rightNiece.SetBlack()
+				sibling.SetRed()
+				sibling.rotateLeftNoFixup()
+				parent.left = rightNiece
+				sibling, rightNiece, leftNiece = rightNiece, rightNiece.right, sibling
+			}
+
+			// Case 5
+			sibling.CopyColorOf(parent)
+			parent.SetBlack()
+			leftNiece.SetBlack()
+			parent.rotateRightNoFixup()
+			t.fixupAfterRotate(parent)
+			return
+		}
+	}
+}
+
+// Same as deleteNode.
+func (t *funcTree[T]) deleteNode(x *gnode[T]) (deleted T) {
+	deleted = x.value
+
+	if x.HasLeftChild() && x.HasRightChild() {
+		succ := x.right.min()
+		x.value = succ.value
+		x = succ
+	}
+
+	child := x.left
+	if !x.HasLeftChild() {
+		child = x.right
+	}
+
+	parent := x.parent
+	child.parent = parent
+
+	if x.IsRoot() {
+		child.SetBlack()
+		t.root = child
+		return
+	}
+
+	if x.IsLeftChildOf(parent) {
+		parent.left = child
+	} else {
+		parent.right = child
+	}
+
+	if x.IsRed() {
+		return
+	}
+
+	if child.IsRed() {
+		child.SetBlack()
+		return
+	}
+
+	t.balanceAfterDelete(child)
+	return
+}
+
+func (t funcTree[T]) Empty() bool {
+	return t.root == nil
+}
+
+func (t funcTree[T]) Size() int {
+	return t.size
+}
+
+// Returns the node holding a value equal to v, or nil if there is none.
+func (t funcTree[T]) find(v T) *gnode[T] {
+	for n := t.root; n != nil && !n.isLeaf(); {
+		switch c := t.cmp(v, n.value); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n
+		}
+	}
+
+	return nil
+}
+
+// Returns the node holding the smallest value greater than or equal to v, or
+// nil if there is none.
+func (t funcTree[T]) lowerBound(v T) *gnode[T] {
+	var bound *gnode[T]
+	for n := t.root; n != nil && !n.isLeaf(); {
+		if t.cmp(n.value, v) < 0 {
+			n = n.right
+		} else {
+			bound, n = n, n.left
+		}
+	}
+
+	return bound
+}
+
+// Returns the node holding the smallest value greater than v, or nil if there
+// is none.
+func (t funcTree[T]) upperBound(v T) *gnode[T] {
+	var bound *gnode[T]
+	for n := t.root; n != nil && !n.isLeaf(); {
+		if t.cmp(n.value, v) <= 0 {
+			n = n.right
+		} else {
+			bound, n = n, n.left
+		}
+	}
+
+	return bound
+}
+
+// Inserts v into the tree if an equal value is not already present, returning
+// true if it was inserted.
+func (t *funcTree[T]) insert(v T) bool {
+	if t.leaf == nil {
+		t.leaf = &gnode[T]{black: true}
+	}
+
+	n := &gnode[T]{value: v, left: t.leaf, right: t.leaf}
+	if t.Empty() {
+		n.SetBlack()
+		t.root = n
+		t.size += 1
+		return true
+	}
+
+	place := t.root
+	for {
+		c := t.cmp(v, place.value)
+		if c == 0 {
+			return false
+		}
+
+		child := &place.left
+		if c > 0 {
+			child = &place.right
+		}
+
+		if (*child).isLeaf() {
+			*child = n
+			break
+		}
+
+		place = *child
+	}
+
+	n.parent = place
+	t.size += 1
+	t.balanceAfterInsert(n)
+	return true
+}
+
+// Deletes the value equal to v from the tree, returning true if one was found.
+func (t *funcTree[T]) delete(v T) bool {
+	n := t.find(v)
+	if n == nil {
+		return false
+	}
+
+	t.deleteNode(n)
+	t.size -= 1
+
+	// If we deleted the last element in the tree, we now have the leaf
+	// sentinel as the root pointer.
+	if t.root == t.leaf {
+		t.root = nil
+	}
+
+	return true
+}
+
+// Removes all values from the tree.
+func (t *funcTree[T]) clear() {
+	t.root = nil
+	t.size = 0
+}
+
+// Returns the node holding the smallest value, or nil if the tree is empty.
+func (t funcTree[T]) first() *gnode[T] {
+	if t.Empty() {
+		return nil
+	}
+
+	return t.root.min()
+}
+
+// Returns the node holding the largest value, or nil if the tree is empty.
+func (t funcTree[T]) last() *gnode[T] {
+	if t.Empty() {
+		return nil
+	}
+
+	return t.root.max()
+}
+
+// The generic counterpart of Iterator, which enumerates the values of a
+// FuncTree or an OrderedTree.
+type TypedIterator[T any] struct {
+	node *gnode[T]
+}
+
+// Advances an iterator to the previous element in the tree. Prev must
+// not be called if the iterator is no longer valid.
+func (it *TypedIterator[T]) Prev() {
+	it.node = it.node.predecessor()
+}
+
+// Advances an iterator to the next element in the tree. Next must
+// not be called if the iterator is no longer valid.
+func (it *TypedIterator[T]) Next() {
+	it.node = it.node.successor()
+}
+
+// Returns the value pointed to by the iterator. Value must not be called
+// if the iterator is no longer valid.
+func (it TypedIterator[T]) Value() T { return it.node.value }
+
+// Returns true if the iterator points to an element in the tree.
+func (it TypedIterator[T]) IsValid() bool { return it.node != nil }
@@ -0,0 +1,43 @@
+package rbtree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"slices"
+)
+
+// Encodes the items of the tree in ascending order with encoding/gob. Since
+// the items are encoded as interface values, the caller must register every
+// concrete Item type with gob.Register before encoding or decoding a tree.
+//
+// Runs in O(n) time.
+func (t Tree) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(t.inner.ToSlice()); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Replaces the contents of the tree with items encoded by GobEncode. As with
+// GobEncode, the concrete Item types must be registered with gob.Register. If
+// the data contains a nil Item, GobDecode fails and leaves the tree unchanged.
+//
+// Runs in O(n) time.
+func (t *Tree) GobDecode(data []byte) error {
+	defer t.check("GobDecode")
+
+	var items []Item
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&items); err != nil {
+		return err
+	}
+
+	if i := slices.Index(items, nil); i >= 0 {
+		return fmt.Errorf("rbtree: item %d: decoded %w", i, ErrNilItem)
+	}
+
+	t.inner.replaceWith(buildDecoded(items))
+	return nil
+}
@@ -0,0 +1,82 @@
+package rbtree
+
+// An Item with a closed range of endpoints, which can be stored in an
+// IntervalTree. Less must order intervals by their low endpoints: if a.Less(b),
+// then the low endpoint of b must not be less than that of a. Intervals with
+// equal low endpoints may be ordered arbitrarily, for instance by their high
+// endpoints.
+type Interval interface {
+	Item
+
+	// Returns the endpoints of the interval. hi must not be less than lo.
+	Endpoints() (lo, hi Item)
+}
+
+// A red-black tree of Intervals which can find every interval overlapping a
+// query range. Each node records the largest high endpoint in its subtree, so
+// that searches can skip subtrees whose intervals all end too early.
+//
+// IntervalTree has all the methods of Tree, and every item inserted into it
+// must be an Interval.
+type IntervalTree struct {
+	Tree
+}
+
+// The aggregate of an IntervalTree: the largest high endpoint of the intervals
+// in each subtree, or nil for an empty one.
+var maxEnd = &monoid{
+	value: func(item Item) interface{} {
+		_, hi := item.(Interval).Endpoints()
+		return hi
+	},
+	combine: func(a, b interface{}) interface{} {
+		if a == nil || b != nil && a.(Item).Less(b.(Item)) {
+			return b
+		}
+
+		return a
+	},
+}
+
+// Returns an empty interval tree.
+func NewInterval() IntervalTree {
+	return IntervalTree{Tree{inner: tree{monoid: maxEnd}}}
+}
+
+// Returns the intervals in the tree which overlap the closed range [lo, hi],
+// sorted by Less. An interval overlaps the range if neither lies entirely
+// before the other.
+//
+// Runs in O(min(n, (k+1) log n)) time, where k is the number of intervals
+// returned.
+func (t IntervalTree) SearchOverlapping(lo, hi Item) []Item {
+	var overlapping []Item
+	if !t.Empty() && lo != nil && hi != nil {
+		overlapping = searchOverlapping(t.inner.root, lo, hi, overlapping)
+	}
+
+	return overlapping
+}
+
+// Appends the intervals of the subtree rooted at n which overlap [lo, hi] to
+// overlapping, in ascending order.
+func searchOverlapping(n *node, lo, hi Item, overlapping []Item) []Item {
+	// Every interval in the subtree ends before the range starts.
+	if n == nilChild || n.aug.value.(Item).Less(lo) {
+		return overlapping
+	}
+
+	overlapping = searchOverlapping(n.left, lo, hi, overlapping)
+
+	// This interval and those to its right start after the range ends.
+	start, end := n.item.(Interval).Endpoints()
+	if hi.Less(start) {
+		return overlapping
+	}
+
+	if !end.Less(lo) {
+		overlapping = append(overlapping, n.item)
+	}
+
+	return searchOverlapping(n.right, lo, hi, overlapping)
+}
@@ -2,28 +2,268 @@ package rbtree
 
 // Iterators are an efficient way to enumerate the items contained within a
 // tree. Iterators are bidirectional (they can be advanced forwards or backwards)
-// but not random access (they cannot advanced by more than one step at a time).
+// but not random access (Next and Prev take one step at a time, although Advance
+// can take many in O(log n) time).
+//
+// Inserting or deleting items invalidates every Iterator into the tree, since
+// deletion may free the node an Iterator points to or move another item into
+// it. To delete items while iterating, use DeleteIterator, which returns a
+// valid Iterator to the next item.
+//
+// An Iterator remembers the root of its tree, so after the tree is modified,
+// an iterator which has been advanced past either end of the tree may no
+// longer be == to a new End. Compare iterators with Equal and AtEnd instead.
 type Iterator struct {
 	node *node
+
+	// The root of the tree when the iterator was created, which lets Prev
+	// step from End to the last item.
+	root *node
+
+	// If true, the iterator was obtained from a flipped tree, and Next and
+	// Prev step in the opposite direction.
+	reversed bool
 }
 
-// Advances an iterator to the previous element in the tree. Prev must
-// not be called if the iterator is no longer valid.
+// Advances an iterator to the previous element in the tree. If the iterator is
+// End, Prev moves it to the last item, so that a loop can run backwards from
+// End. Otherwise, Prev must not be called if the iterator is no longer valid.
 func (it *Iterator) Prev() {
-	it.node = predecessor(it.node)
+	if it.node == nil {
+		switch {
+		case it.root == nil:
+		case it.reversed:
+			it.node = min(it.root)
+		default:
+			it.node = max(it.root)
+		}
+
+		return
+	}
+
+	if it.reversed {
+		it.node = successor(it.node)
+	} else {
+		it.node = predecessor(it.node)
+	}
 }
 
 // Advances an iterator to the next element in the tree. Next must
 // not be called if the iterator is no longer valid.
 func (it *Iterator) Next() {
-	it.node = successor(it.node)
+	if it.reversed {
+		it.node = predecessor(it.node)
+	} else {
+		it.node = successor(it.node)
+	}
+}
+
+// Moves an iterator to the item LowerBound(item) would return on its tree: the
+// first item not less than item, or, for an iterator from a flipped tree, the
+// first item not greater than it in descending order. If there is no such
+// item, the iterator becomes End. Seek may be called on any iterator into the
+// tree, including End, but not after the tree has been modified since the
+// iterator was created.
+//
+// Runs in O(log n) time.
+func (it *Iterator) Seek(item Item) {
+	t := tree{root: it.root}
+	if it.reversed {
+		it.node = t.floor(item)
+	} else {
+		it.node = t.ceiling(item)
+	}
+}
+
+// Advances an iterator by n items: forwards as if by n calls to Next if n is
+// positive, or backwards as if by -n calls to Prev if n is negative. If that
+// would step past either end of the tree, the iterator becomes End instead. As
+// with Prev, stepping backwards from End starts at the last item. Advance must
+// not be called after the tree has been modified since the iterator was
+// created.
+//
+// Runs in O(log n) time, using the subtree sizes to find the target item
+// without visiting the items in between.
+func (it *Iterator) Advance(n int) {
+	if n == 0 || it.root == nil {
+		return
+	}
+
+	// Positions are ascending, so a reversed iterator moves the other way.
+	if it.reversed {
+		n = -n
+	}
+
+	t := tree{root: it.root, size: it.root.size}
+	it.node = t.selectNode(it.index() + n)
+}
+
+// Returns an independent copy of the iterator, pointing to the same item.
+// Advancing either iterator does not affect the other, so a copy can scan ahead
+// while the original keeps its place.
+func (it Iterator) Clone() Iterator {
+	return it
 }
 
 // Returns the item pointed to by the iterator. Item must not be called
 // if the iterator is no longer valid.
 func (it Iterator) Item() Item { return it.node.item }
 
+// Returns sub(next, current), where current is the item pointed to by the
+// iterator and next is the item after it, along with true. Returns false if the
+// iterator points to the last item. GapToNext must not be called if the
+// iterator is no longer valid.
+func (it Iterator) GapToNext(sub func(a, b Item) float64) (float64, bool) {
+	next := it
+	next.Next()
+	if !next.IsValid() {
+		return 0, false
+	}
+
+	return sub(next.Item(), it.Item()), true
+}
+
 // Returns true if the iterator points to an element in the tree. Once the
 // iterator is advanced past the last (or first) element in the tree, IsValid
 // will return false.
 func (it Iterator) IsValid() bool { return it.node != nil }
+
+// Returns true if the iterator is an End, having been advanced past the last
+// (or first) element in the tree. This is the same as !IsValid, but reads
+// better as a loop condition:
+//
+//	for it := tree.First(); !it.AtEnd(); it.Next() {
+//		...
+//	}
+func (it Iterator) AtEnd() bool { return it.node == nil }
+
+// Returns true if the two iterators point to the same item and step in the same
+// direction, or are both End. Loops should compare iterators with Equal or
+// AtEnd rather than ==: an Iterator also remembers the root of its tree, so an
+// End reached before the tree was modified is Equal to, but not ==, a new End.
+func (it Iterator) Equal(other Iterator) bool {
+	return it.node == other.node && it.reversed == other.reversed
+}
+
+// Returns the number of times Next must be called on begin for it to reach end.
+// begin and end must come from the same tree, and begin must not be after end;
+// if it is, the result is negative and meaningless. Either iterator may be the
+// tree's End.
+//
+// This is useful for pagination, or for finding the index of an iterator with
+// Distance(tree.First(), it).
+//
+// Runs in O(log n) time.
+func Distance(begin, end Iterator) int {
+	b, e := begin.index(), end.index()
+	if begin.reversed {
+		return b - e
+	}
+
+	return e - b
+}
+
+// Returns the position of an iterator in ascending order. The End of a tree is
+// past the maximum when iterating forwards and before the minimum when
+// iterating backwards.
+func (it Iterator) index() int {
+	switch {
+	case it.node != nil:
+		return position(it.node)
+	case it.reversed:
+		return -1
+	case it.root == nil:
+		return 0
+	default:
+		return it.root.size
+	}
+}
+
+// Returns the number of nodes before n in its tree.
+func position(n *node) int {
+	index := n.left.size
+	for ; !n.IsRoot(); n = n.Parent() {
+		if n.IsRightChildOf(n.Parent()) {
+			index += n.Parent().left.size + 1
+		}
+	}
+
+	return index
+}
+
+// A RangeIterator is an Iterator confined to the items in a half-open range
+// [lo, hi). Advancing it past either end of the range makes it invalid, so a
+// loop using it cannot stray outside the range even if it never compares
+// against an end iterator. Once invalid, a RangeIterator stays invalid.
+type RangeIterator struct {
+	node *node
+
+	// The first node in the range, and the first node after it (or nil).
+	first, end *node
+
+	// If true, the range was taken from a flipped tree, and Next and Prev
+	// step in the opposite direction.
+	reversed bool
+}
+
+// Returns a RangeIterator pointing to the smallest item greater than or equal
+// to lo and confined to the items less than hi. In a flipped tree, it points
+// to the largest item less than or equal to lo, is confined to the items
+// greater than hi, and steps in descending order.
+//
+// Runs in O(log n) time.
+func (t Tree) RangeIterator(lo, hi Item) *RangeIterator {
+	if t.Empty() || lo == nil || hi == nil {
+		return &RangeIterator{}
+	}
+
+	// The range is empty unless lo comes before hi in the order of the tree.
+	if t.reversed && !hi.Less(lo) || !t.reversed && !lo.Less(hi) {
+		return &RangeIterator{}
+	}
+
+	first, end := t.LowerBound(lo).node, t.LowerBound(hi).node
+	if first == end {
+		return &RangeIterator{}
+	}
+
+	return &RangeIterator{node: first, first: first, end: end, reversed: t.reversed}
+}
+
+// Advances the iterator to the previous item, or makes it invalid if it was
+// pointing to the first item in the range.
+func (it *RangeIterator) Prev() {
+	switch {
+	case it.node == nil || it.node == it.first:
+		it.node = nil
+	case it.reversed:
+		it.node = successor(it.node)
+	default:
+		it.node = predecessor(it.node)
+	}
+}
+
+// Advances the iterator to the next item, or makes it invalid if it was
+// pointing to the last item in the range.
+func (it *RangeIterator) Next() {
+	if it.node == nil {
+		return
+	}
+
+	if it.reversed {
+		it.node = predecessor(it.node)
+	} else {
+		it.node = successor(it.node)
+	}
+
+	if it.node == it.end {
+		it.node = nil
+	}
+}
+
+// Returns the item pointed to by the iterator. Item must not be called
+// if the iterator is no longer valid.
+func (it *RangeIterator) Item() Item { return it.node.item }
+
+// Returns true if the iterator points to an item in its range.
+func (it *RangeIterator) IsValid() bool { return it.node != nil }
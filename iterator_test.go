@@ -2,6 +2,8 @@ package rbtree
 
 import (
 	"fmt"
+	"math/rand"
+	"reflect"
 	"testing"
 )
 
@@ -34,7 +36,7 @@ func ExampleIterator() {
 	tree.Insert(Int(3))
 
 	end, _ := tree.Find(Int(4))
-	for it := tree.First(); it != end; it.Next() {
+	for it := tree.First(); !it.Equal(end); it.Next() {
 		fmt.Printf("%d ", it.Item().(Int))
 	}
 	// Output: 1 2 3
@@ -54,6 +56,39 @@ func ExampleIterator_reverse() {
 	// Output: 3 2 1
 }
 
+func ExampleTree_RFirst() {
+	tree := New()
+	for _, i := range []int{2, 4, 1, 5, 3} {
+		tree.Insert(Int(i))
+	}
+
+	for it := tree.RFirst(); !it.AtEnd(); it.Next() {
+		fmt.Printf("%d ", it.Item().(Int))
+	}
+	// Output: 5 4 3 2 1
+}
+
+func ExampleTree_DeleteIterator() {
+	tree := New()
+	for i := 1; i <= 8; i++ {
+		tree.Insert(Int(i))
+	}
+
+	// Delete the even items while iterating over the whole tree.
+	for it := tree.First(); !it.AtEnd(); {
+		if it.Item().(Int)%2 == 0 {
+			it = tree.DeleteIterator(it)
+		} else {
+			it.Next()
+		}
+	}
+
+	for it := tree.First(); !it.AtEnd(); it.Next() {
+		fmt.Printf("%d ", it.Item().(Int))
+	}
+	// Output: 1 3 5 7
+}
+
 func ExampleIterator_UpperBound() {
 	tree := NewMultiValued()
 	tree.Insert(Int(2))
@@ -62,8 +97,453 @@ func ExampleIterator_UpperBound() {
 	tree.Insert(Int(3))
 	tree.Insert(Int(2))
 
-	for it, end := tree.LowerBound(Int(2)), tree.UpperBound(Int(2)); it != end; it.Next() {
+	for it, end := tree.LowerBound(Int(2)), tree.UpperBound(Int(2)); !it.Equal(end); it.Next() {
 		fmt.Printf("%d ", it.Item().(Int))
 	}
 	// Output: 2 2 2
 }
+
+func TestRangeIterator(t *testing.T) {
+	tree := New()
+	for i := 1; i <= 9; i++ {
+		tree.Insert(Int(i))
+	}
+
+	var got []int
+	for it := tree.RangeIterator(Int(3), Int(7)); it.IsValid(); it.Next() {
+		got = append(got, int(it.Item().(Int)))
+	}
+
+	if fmt.Sprint(got) != "[3 4 5 6]" {
+		t.Errorf("Forward iteration yielded %v", got)
+	}
+
+	// Walk forwards to the last item, then backwards off the front.
+	it := tree.RangeIterator(Int(3), Int(7))
+	for i := 0; i < 3; i++ {
+		it.Next()
+	}
+
+	got = nil
+	for ; it.IsValid(); it.Prev() {
+		got = append(got, int(it.Item().(Int)))
+	}
+
+	if fmt.Sprint(got) != "[6 5 4 3]" {
+		t.Errorf("Reverse iteration yielded %v", got)
+	}
+
+	it.Next()
+	if it.IsValid() {
+		t.Error("An invalid RangeIterator became valid again")
+	}
+
+	for _, r := range [][2]int{{7, 3}, {5, 5}, {10, 20}, {-5, 0}} {
+		if tree.RangeIterator(Int(r[0]), Int(r[1])).IsValid() {
+			t.Errorf("Range [%d, %d) should be empty", r[0], r[1])
+		}
+	}
+
+	// A flipped tree's ranges run in descending order.
+	tree.Flip()
+	got = nil
+	for it = tree.RangeIterator(Int(7), Int(3)); it.IsValid(); it.Next() {
+		got = append(got, int(it.Item().(Int)))
+	}
+
+	if fmt.Sprint(got) != "[7 6 5 4]" {
+		t.Errorf("Flipped iteration yielded %v", got)
+	}
+
+	it = tree.RangeIterator(Int(20), Int(7))
+	it.Next()
+	got = nil
+	for ; it.IsValid(); it.Prev() {
+		got = append(got, int(it.Item().(Int)))
+	}
+
+	if fmt.Sprint(got) != "[8 9]" {
+		t.Errorf("Flipped reverse iteration yielded %v", got)
+	}
+
+	for _, r := range [][2]int{{3, 7}, {5, 5}, {0, -5}, {20, 10}} {
+		if tree.RangeIterator(Int(r[0]), Int(r[1])).IsValid() {
+			t.Errorf("Flipped range [%d, %d) should be empty", r[0], r[1])
+		}
+	}
+}
+
+func TestGapToNext(t *testing.T) {
+	sub := func(a, b Item) float64 { return float64(a.(Int) - b.(Int)) }
+
+	check := func(tree Tree, expected string) {
+		var gaps []float64
+		for it := tree.First(); it.IsValid(); it.Next() {
+			gap, ok := it.GapToNext(sub)
+			if !ok {
+				if !it.Equal(tree.Last()) {
+					t.Errorf("GapToNext reported no successor for %v", it.Item())
+				}
+
+				continue
+			}
+
+			gaps = append(gaps, gap)
+		}
+
+		if fmt.Sprint(gaps) != expected {
+			t.Errorf("Expected gaps %s, got %v", expected, gaps)
+		}
+	}
+
+	even, uneven := New(), New()
+	for _, i := range []int{0, 5, 10, 15} {
+		even.Insert(Int(i))
+	}
+
+	for _, i := range []int{1, 2, 4, 8, 16} {
+		uneven.Insert(Int(i))
+	}
+
+	check(even, "[5 5 5]")
+	check(uneven, "[1 2 4 8]")
+}
+
+func TestDistance(t *testing.T) {
+	tree := New()
+	for i := 0; i < 50; i++ {
+		tree.Insert(Int(i * 2))
+	}
+
+	for lo := 0; lo <= 100; lo += 7 {
+		for hi := lo; hi <= 101; hi += 5 {
+			begin, end := tree.LowerBound(Int(lo)), tree.LowerBound(Int(hi))
+
+			expected := 0
+			for it := begin; !it.Equal(end); it.Next() {
+				expected += 1
+			}
+
+			if d := Distance(begin, end); d != expected {
+				t.Errorf("Distance(%d, %d) = %d, expected %d", lo, hi, d, expected)
+			}
+		}
+	}
+
+	if d := Distance(tree.First(), tree.End()); d != tree.Size() {
+		t.Errorf("Distance(First, End) = %d, expected %d", d, tree.Size())
+	}
+
+	if d := Distance(tree.End(), tree.End()); d != 0 {
+		t.Errorf("Distance(End, End) = %d", d)
+	}
+
+	tree.Flip()
+	if d := Distance(tree.First(), tree.End()); d != tree.Size() {
+		t.Errorf("Distance(First, End) = %d on a flipped tree", d)
+	}
+
+	if d := Distance(tree.LowerBound(Int(40)), tree.LowerBound(Int(30))); d != 5 {
+		t.Errorf("Distance(40, 30) = %d on a flipped tree, expected 5", d)
+	}
+}
+
+func TestReverseIteration(t *testing.T) {
+	var empty Tree
+	if !empty.RFirst().AtEnd() {
+		t.Errorf("RFirst of an empty tree is not REnd")
+	}
+
+	tree := New()
+	for i := 1; i <= 5; i++ {
+		tree.Insert(Int(i))
+	}
+
+	collect := func(tree Tree) (items []Item) {
+		for it := tree.RFirst(); !it.AtEnd(); it.Next() {
+			items = append(items, it.Item())
+		}
+		return
+	}
+
+	if items := fmt.Sprint(collect(tree)); items != "[5 4 3 2 1]" {
+		t.Errorf("Reverse iteration visited %s", items)
+	}
+
+	// Prev steps a reverse iterator back towards the last item.
+	it := tree.RFirst()
+	it.Next()
+	it.Next()
+	it.Prev()
+	if it.Item() != Int(4) {
+		t.Errorf("Prev on a reverse iterator moved to %v", it.Item())
+	}
+
+	tree.Flip()
+	if items := fmt.Sprint(collect(tree)); items != "[1 2 3 4 5]" {
+		t.Errorf("Reverse iteration of a flipped tree visited %s", items)
+	}
+
+	multi := NewMultiValued()
+	for _, i := range []int{1, 2, 2} {
+		multi.Insert(Int(i))
+	}
+	var items []Item
+	for it := multi.RFirst(); !it.AtEnd(); it.Next() {
+		items = append(items, it.Item())
+	}
+	if fmt.Sprint(items) != "[2 2 1]" {
+		t.Errorf("Reverse iteration of a multi-valued tree visited %v", items)
+	}
+}
+
+func TestPrevFromEnd(t *testing.T) {
+	var empty Tree
+	it := empty.End()
+	it.Prev()
+	if !it.AtEnd() {
+		t.Errorf("Prev on the End of an empty tree moved to %v", it.Item())
+	}
+
+	tree := New()
+	for i := 1; i <= 5; i++ {
+		tree.Insert(Int(i))
+	}
+
+	var items []Item
+	it = tree.End()
+	for it.Prev(); !it.AtEnd(); it.Prev() {
+		items = append(items, it.Item())
+	}
+	if fmt.Sprint(items) != "[5 4 3 2 1]" {
+		t.Errorf("Iterating backwards from End visited %v", items)
+	}
+
+	// Stepping past the first item and back lands on Last again.
+	it.Prev()
+	if !it.Equal(tree.Last()) {
+		t.Errorf("Prev on an iterator before the first item moved to %v", it.Item())
+	}
+
+	tree.Flip()
+	it = tree.End()
+	it.Prev()
+	if !it.Equal(tree.Last()) || it.Item() != Int(1) {
+		t.Errorf("Prev on the End of a flipped tree moved to %v", it.Item())
+	}
+}
+
+func TestIteratorClone(t *testing.T) {
+	tree := New()
+	for i := 1; i <= 5; i++ {
+		tree.Insert(Int(i))
+	}
+
+	bookmark, _ := tree.Find(Int(2))
+	ahead := bookmark.Clone()
+	ahead.Next()
+	ahead.Next()
+
+	if bookmark.Item() != Int(2) || ahead.Item() != Int(4) {
+		t.Errorf("Advancing a clone moved the original: %v, %v", bookmark.Item(), ahead.Item())
+	}
+
+	behind := bookmark.Clone()
+	bookmark.Prev()
+	if behind.Item() != Int(2) || bookmark.Item() != Int(1) {
+		t.Errorf("Advancing the original moved the clone: %v, %v", bookmark.Item(), behind.Item())
+	}
+}
+
+func TestDeleteWhileIterating(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 10, 257, 1000} {
+		tree := New()
+		odd := []int{}
+		for i := 0; i < size; i++ {
+			tree.Insert(Int(i))
+			if i%2 == 1 {
+				odd = append(odd, i)
+			}
+		}
+
+		for it := tree.First(); !it.AtEnd(); {
+			if it.Item().(Int)%2 == 0 {
+				it = tree.DeleteIterator(it)
+			} else {
+				it.Next()
+			}
+		}
+
+		checkTree(t, tree.inner, odd)
+		if err := tree.DebugValidate(); err != nil {
+			t.Fatalf("Deleting even items from a tree of size %d left it invalid: %v", size, err)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	tree := New()
+	for i := 0; i < 20; i += 2 {
+		tree.Insert(Int(i))
+	}
+
+	it := tree.First()
+	seek := func(target Int, expected Item) {
+		t.Helper()
+		it.Seek(target)
+		if expected == nil {
+			if !it.AtEnd() {
+				t.Errorf("Seek(%d) moved to %v, expected End", target, it.Item())
+			}
+		} else if !it.IsValid() || it.Item() != expected {
+			t.Errorf("Seek(%d) did not move to %v", target, expected)
+		}
+	}
+
+	seek(10, Int(10))
+	seek(4, Int(4))
+	seek(13, Int(14))
+	seek(-5, Int(0))
+	seek(19, nil)
+
+	// End can seek back into the tree, and the iterator still steps from there.
+	seek(7, Int(8))
+	it.Next()
+	if it.Item() != Int(10) {
+		t.Errorf("Next after Seek moved to %v", it.Item())
+	}
+
+	tree.Flip()
+	it = tree.End()
+	seek(7, Int(6))
+	seek(100, Int(18))
+	seek(-1, nil)
+
+	empty := New().End()
+	empty.Seek(Int(1))
+	if empty.IsValid() {
+		t.Errorf("Seek on an empty tree found an item")
+	}
+}
+
+func TestFirstLastAreMinMax(t *testing.T) {
+	tree := New()
+	if !tree.First().AtEnd() || !tree.Last().AtEnd() || tree.Min() != nil || tree.Max() != nil {
+		t.Fatalf("Empty tree has a minimum or maximum")
+	}
+
+	for _, i := range rand.Perm(50) {
+		tree.Insert(Int(i))
+	}
+
+	for _, flipped := range []bool{false, true} {
+		if tree.First().Item() != tree.Min() || tree.Last().Item() != tree.Max() {
+			t.Errorf("First and Last are not Min and Max (flipped: %v)", flipped)
+		}
+
+		// Stepping inward from either end visits every item in order.
+		forward, backward := []Item{}, []Item{}
+		for it := tree.First(); !it.AtEnd(); it.Next() {
+			forward = append(forward, it.Item())
+		}
+		for it := tree.Last(); !it.AtEnd(); it.Prev() {
+			backward = append([]Item{it.Item()}, backward...)
+		}
+		if len(forward) != 50 || !reflect.DeepEqual(forward, backward) {
+			t.Errorf("Iterating from the ends disagreed (flipped: %v)", flipped)
+		}
+		if forward[0] != tree.Min() || forward[49] != tree.Max() {
+			t.Errorf("Iteration did not run from Min to Max (flipped: %v)", flipped)
+		}
+
+		tree.Flip()
+	}
+
+	multi := NewMultiValued()
+	for _, i := range []int{3, 1, 3, 2} {
+		multi.Insert(Int(i))
+	}
+	if multi.First().Item() != multi.Min() || multi.Last().Item() != multi.Max() {
+		t.Errorf("First and Last of a MultiValuedTree are not Min and Max")
+	}
+}
+
+func TestIteratorEqual(t *testing.T) {
+	tree := treeOf(1, 2, 3)
+	it := tree.Last()
+	it.Next()
+	if !it.AtEnd() || !it.Equal(tree.End()) {
+		t.Fatalf("Iterator advanced past Last is not End")
+	}
+
+	// The root changes, but the old End is still Equal to the new one.
+	for i := 0; i > -10; i-- {
+		tree.Insert(Int(i))
+	}
+	if it == tree.End() {
+		t.Fatalf("Root did not change")
+	}
+	if !it.Equal(tree.End()) || !it.AtEnd() {
+		t.Errorf("End from before an insertion is not Equal to End")
+	}
+
+	first, found := tree.First(), tree.FindItem(Int(-9))
+	if !first.Equal(tree.LowerBound(found)) || first.Equal(tree.Last()) || first.AtEnd() {
+		t.Errorf("Equal compared iterators incorrectly")
+	}
+	if tree.End().Equal(tree.REnd()) {
+		t.Errorf("End and REnd step in different directions but are Equal")
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	tree := treeOf(0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+
+	tests := []struct {
+		start, n int
+		expected Item
+	}{
+		{0, 0, Int(0)},
+		{2, 5, Int(7)},
+		{7, -5, Int(2)},
+		{9, 1, nil},
+		{3, 100, nil},
+		{0, -1, nil},
+		{5, -100, nil},
+		{-1, -1, Int(9)},
+		{-1, -10, Int(0)},
+		{-1, -11, nil},
+		{-1, 3, nil},
+	}
+
+	for _, flipped := range []bool{false, true} {
+		for _, test := range tests {
+			it := tree.End()
+			if test.start >= 0 {
+				it = tree.First()
+				for i := 0; i < test.start; i++ {
+					it.Next()
+				}
+			}
+
+			// A flipped tree steps through the same positions in reverse.
+			expected := test.expected
+			if flipped && expected != nil {
+				expected = Int(9) - expected.(Int)
+			}
+
+			it.Advance(test.n)
+			if expected == nil && !it.AtEnd() || expected != nil && (it.AtEnd() || it.Item() != expected) {
+				t.Errorf("Advancing from %d by %d did not reach %v (flipped: %v)", test.start, test.n, expected, flipped)
+			}
+		}
+
+		tree.Flip()
+	}
+
+	empty := New().End()
+	empty.Advance(-3)
+	if !empty.AtEnd() {
+		t.Errorf("Advancing in an empty tree found an item")
+	}
+}
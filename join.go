@@ -0,0 +1,257 @@
+package rbtree
+
+// Joins the subtrees l and r, whose items are respectively less than and greater
+// than the item of the detached node k, into a single subtree and returns its
+// root. l and r may be nilChild, and must not be used after the call.
+//
+// If the subtrees have the same black height, k simply becomes their parent.
+// Otherwise, k is colored red and attached in place of the black node along
+// the inner spine of the taller subtree whose black height equals that of the
+// shorter one, which preserves the black height of every path. The only
+// invariant this can violate is a red k with a red parent, which is exactly
+// the situation balanceAfterInsert repairs.
+func join(l, k, r *node) *node {
+	// A red root would become the red child of a red k; blackening it first
+	// only adds one to the black height of its subtree.
+	l.SetBlack()
+	r.SetBlack()
+
+	hl, hr := blackHeight(l), blackHeight(r)
+	k.SetParent(nil)
+	switch {
+	case hl == hr:
+		k.left, k.right = l, r
+		l.SetParent(k)
+		r.SetParent(k)
+		k.SetBlack()
+		k.size = l.size + r.size + 1
+		k.updateAggregate()
+		return k
+
+	case hl > hr:
+		// Descend the right spine of l. The root is black, so we always take
+		// at least one step.
+		var p *node
+		c, h := l, hl
+		for !(c.IsBlack() && h == hr) {
+			h -= blackness(c)
+			p, c = c, c.right
+		}
+
+		p.right = k
+		k.left, k.right = c, r
+		c.SetParent(k)
+		r.SetParent(k)
+		return attachJoined(k, p, l, c.size+r.size+1)
+
+	default:
+		var p *node
+		c, h := r, hr
+		for !(c.IsBlack() && h == hl) {
+			h -= blackness(c)
+			p, c = c, c.left
+		}
+
+		p.left = k
+		k.left, k.right = l, c
+		l.SetParent(k)
+		c.SetParent(k)
+		return attachJoined(k, p, r, l.size+c.size+1)
+	}
+}
+
+// Finishes a join in which k, the root of a subtree of the given size, was made
+// a child of p in the tree rooted at root. Returns the new root.
+func attachJoined(k, p, root *node, size int) *node {
+	k.SetParent(p)
+	k.SetRed()
+	k.size = size
+	k.updateAggregate()
+
+	// Every ancestor of k gains the nodes of the shorter subtree and k itself.
+	for q := p; q != nil; q = q.Parent() {
+		q.size = q.left.size + q.right.size + 1
+		q.updateAggregate()
+	}
+
+	balanceAfterInsert(k, &root)
+	return root
+}
+
+// Returns the root of a tree, or nilChild if it is empty.
+func (t tree) rootOrLeaf() *node {
+	if t.Empty() {
+		return nilChild
+	}
+
+	return t.root
+}
+
+// Returns a tree made of the root of a subtree returned by join or split.
+func treeFromRoot(root *node) tree {
+	if root == nilChild {
+		return tree{}
+	}
+
+	root.SetParent(nil)
+	root.SetBlack()
+	return tree{root: root, size: root.size, min: min(root), max: max(root)}
+}
+
+// Joins two trees, all of whose items in a are less than all of those in b.
+// Neither a nor b may be used after the call.
+func merge(a, b tree) tree {
+	// The nodes of b must carry the same kind of aggregate as those of a.
+	if b.monoid != a.monoid {
+		b.setMonoid(a.monoid)
+	}
+
+	if a.Empty() {
+		return b
+	}
+
+	if b.Empty() {
+		return a
+	}
+
+	// Use the minimum of b as the middle node of the join.
+	k := a.newNode(b.remove(b.min), nil)
+	merged := treeFromRoot(join(a.root, k, b.rootOrLeaf()))
+	merged.pooled, merged.free, merged.monoid = a.pooled, a.free, a.monoid
+	return merged
+}
+
+// Splits the subtree rooted at n, which must have no parent, into the subtrees
+// holding the items less than target and the rest, returning their roots.
+// Either may be nilChild.
+func split(n *node, target Item) (less, rest *node) {
+	if n == nilChild {
+		return nilChild, nilChild
+	}
+
+	left, right := n.left, n.right
+	left.SetParent(nil)
+	right.SetParent(nil)
+
+	if n.item.Less(target) {
+		less, rest = split(right, target)
+		return join(left, n, less), rest
+	}
+
+	less, rest = split(left, target)
+	return less, join(rest, n, right)
+}
+
+// Splits a tree into the trees of items less than target and the rest. t must
+// not be used after the call.
+func (t tree) split(target Item) (less, rest tree) {
+	if t.Empty() {
+		return tree{pooled: t.pooled, monoid: t.monoid}, tree{pooled: t.pooled, monoid: t.monoid}
+	}
+
+	l, r := split(t.root, target)
+	less, rest = treeFromRoot(l), treeFromRoot(r)
+	less.pooled, rest.pooled = t.pooled, t.pooled
+	less.monoid, rest.monoid = t.monoid, t.monoid
+	return
+}
+
+// Removes the items greater than or equal to lo and less than hi, returning the
+// number removed, by splitting out the range and merging the pieces around it.
+func (t *tree) deleteRange(lo, hi Item) int {
+	if t.Empty() || lo == nil || hi == nil || !lo.Less(hi) {
+		return 0
+	}
+
+	free := t.free
+	less, rest := t.split(lo)
+	removed, greater := rest.split(hi)
+	*t = merge(less, greater)
+	t.free = free
+	return removed.size
+}
+
+// Inserts a copy of every item of other which is not already in the tree,
+// returning the number inserted. other is not modified. If the items of other
+// all lie on one side of those of the tree, the copy is merged in whole;
+// otherwise, the items are inserted in ascending order with insertSorted.
+func (t *tree) insertAll(other tree) int {
+	if other.Empty() {
+		return 0
+	}
+
+	if t.Empty() || other.max.item.Less(t.min.item) || t.max.item.Less(other.min.item) {
+		// The copy takes on the settings of the tree. Whichever of the two
+		// comes first in the merge supplies the free list of the result, so it
+		// must hold the tree's.
+		c := other.clone()
+		c.pooled = t.pooled
+		if c.monoid != t.monoid {
+			c.setMonoid(t.monoid)
+		}
+
+		switch {
+		case t.Empty():
+			c.free = t.free
+			*t = c
+		case t.max.item.Less(c.min.item):
+			*t = merge(*t, c)
+		default:
+			c.free, t.free = t.free, nil
+			*t = merge(c, *t)
+		}
+
+		return other.size
+	}
+
+	return t.insertSorted(other.ToSlice())
+}
+
+// Inserts each of items which is not already in the tree, returning the number
+// inserted. The items should be sorted in ascending order: each one is then
+// linked next to the first item of the tree after it, which is found by
+// stepping forward from the previous one instead of searching from the root.
+// Items which are out of order are inserted with insertUnique instead.
+func (t *tree) insertSorted(items []Item) int {
+	inserted := 0
+	var next *node
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+
+		if i == 0 || items[i-1] == nil {
+			next = t.ceiling(item)
+		}
+
+		for next != nil && next.item.Less(item) {
+			next = successor(next)
+		}
+
+		if _, ok := t.insertHint(next, item); ok {
+			inserted += 1
+		}
+	}
+
+	return inserted
+}
+
+// Returns 1 if n is black or 0 if it is red.
+func blackness(n *node) int {
+	if n.IsBlack() {
+		return 1
+	}
+
+	return 0
+}
+
+// Returns the number of black nodes on any path from n to a leaf, counting n
+// if it is black.
+func blackHeight(n *node) int {
+	h := 0
+	for ; n != nilChild; n = n.left {
+		h += blackness(n)
+	}
+
+	return h
+}
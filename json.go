@@ -0,0 +1,64 @@
+package rbtree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The decoding function of a tree created by NewJSON. It is kept behind a
+// pointer so that Tree remains comparable.
+type jsonDecoder struct {
+	decode func(json.RawMessage) (Item, error)
+}
+
+// Returns an empty tree which can be filled with UnmarshalJSON, using decode to
+// convert each element of the JSON array into an Item.
+func NewJSON(decode func(json.RawMessage) (Item, error)) Tree {
+	return Tree{decoder: &jsonDecoder{decode}}
+}
+
+// Encodes the tree as a JSON array of its items in ascending order. Every item
+// must have a concrete type which encoding/json can marshal.
+//
+// Runs in O(n) time.
+func (t Tree) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.inner.ToSlice())
+}
+
+// Replaces the contents of the tree with the items of a JSON array, such as
+// one produced by MarshalJSON. Since Item is an interface, the tree must have
+// been created by NewJSON, which supplies the function used to decode each
+// element. If the array contains equivalent items, only the first is kept. If
+// decode returns a nil Item, UnmarshalJSON fails and leaves the tree unchanged.
+//
+// Runs in O(n) time if the array is sorted, as it is when produced by
+// MarshalJSON, or O(n log n) time otherwise.
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	defer t.check("UnmarshalJSON")
+
+	if t.decoder == nil {
+		return errors.New("rbtree: UnmarshalJSON requires a tree created by NewJSON")
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+
+	items := make([]Item, len(elements))
+	for i, element := range elements {
+		item, err := t.decoder.decode(element)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return fmt.Errorf("rbtree: element %d: decoded %w", i, ErrNilItem)
+		}
+
+		items[i] = item
+	}
+
+	t.inner.replaceWith(buildDecoded(items))
+	return nil
+}
@@ -0,0 +1,91 @@
+package rbtree
+
+import "math/bits"
+
+// Rebuilds the tree as balanced as possible, with its nodes stored in a single
+// block of memory in van Emde Boas order: the top half of the levels of the
+// tree is laid out first, followed by each of the subtrees hanging below it,
+// each of which is laid out the same way recursively. A search from the root
+// then touches nodes which are close together in memory, which reduces cache
+// misses in large trees which are read much more often than they are
+// modified.
+//
+// The items, the order the tree is viewed in and its other settings are
+// unchanged, but every Iterator into the tree is invalidated. Later insertions
+// allocate their nodes individually, so the benefit fades as the tree is
+// modified. The block can only be reclaimed by the garbage collector once none
+// of its nodes is in use.
+//
+// Runs in O(n log log n) time.
+func (t *Tree) OptimizeForReads() {
+	defer t.check("OptimizeForReads")
+
+	t.inner.optimizeForReads()
+}
+
+func (t *tree) optimizeForReads() {
+	if t.Empty() {
+		return
+	}
+
+	built := buildSorted(t.ToSlice())
+	order := vebLayout(built.root, bits.Len(uint(built.size)), make([]*node, 0, built.size))
+
+	// Copy the nodes into the block, then point their links at the copies.
+	block := make([]node, len(order))
+	moved := make(map[*node]*node, len(order))
+	for i, n := range order {
+		block[i] = *n
+		moved[n] = &block[i]
+	}
+
+	relink := func(n *node) *node {
+		if n == nilChild || n == nil {
+			return n
+		}
+		return moved[n]
+	}
+
+	for i := range block {
+		n := &block[i]
+		n.left, n.right = relink(n.left), relink(n.right)
+		n.SetParent(relink(n.Parent()))
+	}
+
+	t.root, t.min, t.max = moved[built.root], moved[built.min], moved[built.max]
+	if t.monoid != nil {
+		t.setMonoid(t.monoid)
+	}
+}
+
+// Appends the nodes of the top height levels of the subtree rooted at n to
+// order, in van Emde Boas order.
+func vebLayout(n *node, height int, order []*node) []*node {
+	switch {
+	case n == nilChild || height == 0:
+		return order
+	case height == 1:
+		return append(order, n)
+	}
+
+	top := height / 2
+	order = vebLayout(n, top, order)
+	for _, bottom := range nodesAtDepth(n, top, nil) {
+		order = vebLayout(bottom, height-top, order)
+	}
+
+	return order
+}
+
+// Appends the nodes at the given depth below n to nodes, from left to right.
+func nodesAtDepth(n *node, depth int, nodes []*node) []*node {
+	switch {
+	case n == nilChild:
+		return nodes
+	case depth == 0:
+		return append(nodes, n)
+	}
+
+	nodes = nodesAtDepth(n.left, depth-1, nodes)
+	return nodesAtDepth(n.right, depth-1, nodes)
+}
@@ -1,5 +1,10 @@
 package rbtree
 
+import (
+	"bytes"
+	"time"
+)
+
 // This package also provides wrappers around a few common types to make
 // them suitable for use in a tree, much like the convenience functions
 // provided by 'sort'.
@@ -16,10 +21,20 @@ package rbtree
 // 	}
 //
 // Two items are equal if and only if neither is less than the other.
+//
+// A nil Item is never stored in a tree, since it has no Less method to order
+// it by. Inserting nil does nothing, and returns false where an insertion
+// reports success; searching for nil or deleting it finds nothing, and a range
+// with a nil bound is empty.
 type Item interface {
 	Less(than Item) bool
 }
 
+// Returns true if neither a nor b is less than the other.
+func equivalent(a, b Item) bool {
+	return !a.Less(b) && !b.Less(a)
+}
+
 // Int wraps integers to provide a Less method.
 type Int int
 
@@ -27,6 +42,35 @@ func (item Int) Less(than Item) bool {
 	return item < than.(Int)
 }
 
+// Int64 wraps 64-bit integers to provide a Less method.
+type Int64 int64
+
+func (item Int64) Less(than Item) bool {
+	return item < than.(Int64)
+}
+
+// Uint wraps unsigned integers to provide a Less method.
+type Uint uint
+
+func (item Uint) Less(than Item) bool {
+	return item < than.(Uint)
+}
+
+// Uint64 wraps unsigned 64-bit integers to provide a Less method.
+type Uint64 uint64
+
+func (item Uint64) Less(than Item) bool {
+	return item < than.(Uint64)
+}
+
+// Float32 wraps single-precision floating point numbers to provide a Less
+// method.
+type Float32 float32
+
+func (item Float32) Less(than Item) bool {
+	return item < than.(Float32)
+}
+
 // Float64 wraps floating point numbers to provide a Less method.
 type Float64 float64
 
@@ -40,3 +84,33 @@ type String string
 func (item String) Less(than Item) bool {
 	return item < than.(String)
 }
+
+// Bytes wraps byte slices to provide a Less method, ordering them
+// lexicographically as bytes.Compare does. A nil slice is equivalent to an
+// empty one. The slice must not be modified while it is in a tree.
+type Bytes []byte
+
+func (item Bytes) Less(than Item) bool {
+	return bytes.Compare(item, than.(Bytes)) < 0
+}
+
+// Time wraps times to provide a Less method, ordering them by the instant they
+// represent. Times in different locations which represent the same instant are
+// equivalent.
+type Time time.Time
+
+func (item Time) Less(than Item) bool {
+	return time.Time(item).Before(time.Time(than.(Time)))
+}
+
+// Reversed wraps another Item, inverting its order, so that a tree of Reversed
+// items is sorted in descending order of the wrapped items. Queries such as
+// Find and Delete must wrap their targets the same way. See NewReversed for a
+// tree which reverses its order without wrapping.
+type Reversed struct {
+	Item Item
+}
+
+func (item Reversed) Less(than Item) bool {
+	return than.(Reversed).Item.Less(item.Item)
+}
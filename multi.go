@@ -18,15 +18,19 @@ func (t MultiValuedTree) Empty() bool {
 	return t.inner.Empty()
 }
 
-// Returns the minimum value in the tree or nil if the tree is empty.
-// Runs in O(log n) time.
+// Returns the minimum value in the tree or nil if the tree is empty. First
+// returns an Iterator to the same item, from which the rest of the tree can be
+// visited in ascending order.
+//
+// Runs in O(1) time.
 func (t MultiValuedTree) Min() Item {
 	return t.inner.Min()
 }
 
-// Returns the maximum value in the tree or nil if the tree is empty.
+// Returns the maximum value in the tree or nil if the tree is empty. Last
+// returns an Iterator to the same item.
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t MultiValuedTree) Max() Item {
 	return t.inner.Max()
 }
@@ -43,6 +47,41 @@ func (t *MultiValuedTree) Insert(item Item) {
 	t.inner.Insert(item)
 }
 
+// Replaces the first of the items equivalent to item, in iteration order, with
+// item, returning the replaced item and true. If there is no equivalent item,
+// inserts item and returns nil and false. Unlike Insert, ReplaceFirst never adds
+// a duplicate.
+//
+// Runs in O(log n) time.
+func (t *MultiValuedTree) ReplaceFirst(item Item) (Item, bool) {
+	if item == nil {
+		return nil, false
+	}
+
+	if t.inner.Empty() {
+		t.inner.insertAt(item, nil, equalTo)
+		return nil, false
+	}
+
+	// The leftmost insertion point is either the first equivalent item, or the
+	// item before it, or the place to insert item if there is none.
+	place, ord := getLeftmostInsertionPoint(t.inner.root, item)
+	first := place
+	if ord == greaterThan {
+		first = successor(place)
+	}
+
+	if first == nil || item.Less(first.item) {
+		t.inner.insertAt(item, place, ord)
+		return nil, false
+	}
+
+	old := first.item
+	first.item = item
+	updateAggregatesFrom(first)
+	return old, true
+}
+
 // Removes all items from the tree.
 func (t *MultiValuedTree) Clear() {
 	t.inner.Clear()
@@ -60,6 +99,36 @@ func (t MultiValuedTree) FindItem(item Item) Item {
 	}
 }
 
+// Returns the half-open range [begin, end) of every item equivalent to item,
+// in the order they were inserted, so that all of the duplicates FindItem
+// chooses among can be visited:
+//
+//	for it, end := tree.FindAll(item); !it.Equal(end); it.Next() {
+//		...
+//	}
+//
+// begin == end if there is no such item. This is the same as EqualRange.
+//
+// Runs in O(log n) time.
+func (t MultiValuedTree) FindAll(item Item) (begin, end Iterator) {
+	return t.EqualRange(item)
+}
+
+// Returns true if the tree contains an item equivalent to item. Unlike Find,
+// Contains does not build an Iterator.
+//
+// Runs in O(log n) time.
+func (t MultiValuedTree) Contains(item Item) bool {
+	return t.inner.Contains(item)
+}
+
+// Returns the number of items in the tree which are equivalent to item.
+//
+// Runs in O(log n) time.
+func (t MultiValuedTree) Count(item Item) int {
+	return t.inner.count(item)
+}
+
 // Delete looks for an item equivalent to target in the tree and deletes
 // it, returning the value that was present in the tree. If no item was found,
 // Delete returns nil and does not modify the tree.
@@ -67,22 +136,107 @@ func (t *MultiValuedTree) Delete(item Item) Item {
 	return t.inner.Delete(item)
 }
 
-// Returns an Iterator pointing to the first item in the tree.
+// Deletes every item equivalent to item, returning the number of items deleted.
+// The items are removed one after another from the first of them, each without
+// searching for it, as with DeleteIterator.
+//
+// Runs in O((k + 1) log n) time, where k is the number of items deleted.
+func (t *MultiValuedTree) DeleteAll(item Item) int {
+	if t.Empty() || item == nil {
+		return 0
+	}
+
+	lo, _ := t.inner.equalRange(item)
+	count := t.inner.count(item)
+	for i := 0; i < count; i++ {
+		lo = t.inner.removeAt(lo, false).node
+	}
+
+	return count
+}
+
+// Deletes the item pointed to by it, which must be a valid Iterator into this
+// tree, without searching for it. Unlike Delete, which may remove any of
+// several equivalent items, DeleteIterator removes exactly this one. Returns
+// an Iterator to the item which followed the deleted one, in the direction it
+// steps in, so that a loop can continue from there:
+//
+//	for it := tree.First(); !it.AtEnd(); {
+//		if shouldDelete(it.Item()) {
+//			it = tree.DeleteIterator(it)
+//		} else {
+//			it.Next()
+//		}
+//	}
+//
+// Every other Iterator into the tree is invalidated.
 //
 // Runs in O(log n) time.
+func (t *MultiValuedTree) DeleteIterator(it Iterator) Iterator {
+	return t.inner.removeAt(it.node, it.reversed)
+}
+
+// Removes one of the minimum items from the tree and returns it, or returns nil
+// if the tree is empty. Of several equivalent minimum items, the first one in
+// iteration order is removed.
+//
+// Runs in O(log n) time.
+func (t *MultiValuedTree) PopMin() Item {
+	return t.inner.PopMin()
+}
+
+// Removes one of the maximum items from the tree and returns it, or returns nil
+// if the tree is empty. Of several equivalent maximum items, the last one in
+// iteration order is removed.
+//
+// Runs in O(log n) time.
+func (t *MultiValuedTree) PopMax() Item {
+	return t.inner.PopMax()
+}
+
+// Returns an Iterator pointing to the last item in the tree, which steps
+// backwards: Next moves it to the previous item in the order of the tree, and
+// Prev to the following one. Stepping past the first item with Next makes it
+// equal to REnd, so
+//
+//	for it := tree.RFirst(); !it.AtEnd(); it.Next() { ... }
+//
+// visits every item in reverse order.
+//
+// Runs in O(1) time.
+func (t MultiValuedTree) RFirst() Iterator {
+	it := t.Last()
+	it.reversed = !it.reversed
+	return it
+}
+
+// Returns an invalid Iterator pointing one before the first item of the tree,
+// which marks the end of a reverse iteration begun with RFirst.
+func (t MultiValuedTree) REnd() Iterator {
+	it := t.End()
+	it.reversed = !it.reversed
+	return it
+}
+
+// Returns an Iterator pointing to the first item in the tree, which is the
+// item returned by Min, or End if the tree is empty. Like Min, First does not
+// descend the tree, since the tree keeps track of its minimum.
+//
+// Runs in O(1) time.
 func (t MultiValuedTree) First() Iterator {
 	return t.inner.First()
 }
 
-// Returns an Iterator pointing to the last item in the tree.
+// Returns an Iterator pointing to the last item in the tree, which is the item
+// returned by Max, or End if the tree is empty.
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t MultiValuedTree) Last() Iterator {
 	return t.inner.Last()
 }
 
 // Returns an invalid Iterator pointing one past the beginning/end of
-// the tree. (it != tree.End()) implies it.IsValid().
+// the tree. !it.Equal(tree.End()) implies it.IsValid().
 func (t MultiValuedTree) End() Iterator {
 	return t.inner.End()
 }
@@ -101,3 +255,136 @@ func (t MultiValuedTree) LowerBound(target Item) Iterator {
 func (t MultiValuedTree) UpperBound(target Item) Iterator {
 	return t.inner.UpperBound(target)
 }
+
+// Checks every node in the tree, returning a descriptive error for the first
+// violation found of the red-black invariants, of parent-pointer consistency,
+// or of the in-order sortedness of the items. Returns nil if the tree is
+// consistent. Use this to debug Item types whose Less method does not define a
+// strict weak ordering.
+//
+// Runs in O(n) time.
+func (t MultiValuedTree) DebugValidate() error {
+	return t.inner.validate()
+}
+
+// Returns the half-open range [begin, end) of items equivalent to target, which
+// is the same as LowerBound(target), UpperBound(target), but descends the tree
+// only once. begin == end if there is no such item.
+//
+// Runs in O(log n) time.
+func (t MultiValuedTree) EqualRange(target Item) (begin, end Iterator) {
+	lo, hi := t.inner.equalRange(target)
+	return t.inner.iterAt(lo), t.inner.iterAt(hi)
+}
+
+// Calls fn on each item in the tree in ascending order, stopping early if fn
+// returns false. The tree must not be modified by fn.
+//
+// Runs in O(n) time.
+func (t MultiValuedTree) ForEach(fn func(Item) bool) {
+	forEachRange(t.inner.min, nil, false, fn)
+}
+
+// Calls fn on each item in the half-open range [begin, end), in the order they
+// are visited by calling Next on begin, stopping early if fn returns false.
+// begin and end must come from this tree, and begin must not be after end. The
+// tree must not be modified by fn.
+//
+// Runs in O(m) time, where m is the number of items visited.
+func (t MultiValuedTree) ForEachRange(begin, end Iterator, fn func(Item) bool) {
+	forEachRange(begin.node, end.node, begin.reversed, fn)
+}
+
+// Returns a slice containing every item in the tree in ascending order. The
+// slice is empty but not nil if the tree is empty.
+//
+// Runs in O(n) time.
+func (t MultiValuedTree) ToSlice() []Item {
+	return t.inner.ToSlice()
+}
+
+// Returns a slice containing the items in the half-open range [begin, end), in
+// the order they are visited by calling Next on begin. The slice is empty but
+// not nil if the range is empty. begin and end must come from this tree, and
+// begin must not be after end.
+//
+// Runs in O(log n + m) time, where m is the number of items in the range.
+func (t MultiValuedTree) RangeToSlice(begin, end Iterator) []Item {
+	items := make([]Item, 0, Distance(begin, end))
+	for it := begin; !it.Equal(end); it.Next() {
+		items = append(items, it.Item())
+	}
+
+	return items
+}
+
+// Returns a deep copy of the tree which shares no nodes with the original, so
+// either one can be modified without affecting the other. Since the copy has
+// the same shape as the original, equivalent items keep their relative order.
+// The items themselves are not copied.
+//
+// Runs in O(n) time.
+func (t MultiValuedTree) Clone() MultiValuedTree {
+	return MultiValuedTree{inner: t.inner.clone()}
+}
+
+// Returns a Tree containing the same items as this tree, along with true. The
+// two trees share their nodes, so Iterators into the original tree remain
+// valid and can be used with the new one. Since they share nodes, only one of
+// the two trees should be used after the conversion; modifying either one
+// leaves the other in an inconsistent state.
+//
+// Every Tree method assumes that its items are unique, so if this tree contains
+// equivalent items, AsUnique returns an empty tree and false instead.
+//
+// Runs in O(n) time.
+func (t MultiValuedTree) AsUnique() (Tree, bool) {
+	if t.inner.validateUnique() != nil {
+		return Tree{}, false
+	}
+
+	return Tree{inner: t.inner}, true
+}
+
+// Calls fn for each item in the tree in order, reporting whether the item is
+// the first and the last of a run of equivalent items. An item with no
+// duplicates is both. Iteration stops if fn returns false.
+//
+// The tree must not be modified by fn.
+//
+// Runs in O(n) time.
+func (t MultiValuedTree) ForEachGrouped(fn func(item Item, firstInGroup, lastInGroup bool) bool) {
+	first := true
+	for n := t.inner.First().node; n != nil; {
+		next := successor(n)
+		last := next == nil || n.item.Less(next.item)
+		if !fn(n.item, first, last) {
+			return
+		}
+
+		n, first = next, last
+	}
+}
+
+// Partitions the distinct items of the tree into two unique trees, the first
+// containing the items which appear at least minCount times and the second
+// containing the rest. Only the first of each group of equivalent items is
+// kept.
+//
+// Runs in O(n) time, plus the cost of rebalancing the new trees.
+func (t MultiValuedTree) SplitByCount(minCount int) (frequent Tree, rare Tree) {
+	for n := t.inner.First().node; n != nil; {
+		first, count := n, 0
+		for ; n != nil && !first.item.Less(n.item); n = successor(n) {
+			count += 1
+		}
+
+		if count >= minCount {
+			frequent.inner.append(first.item)
+		} else {
+			rare.inner.append(first.item)
+		}
+	}
+
+	return
+}
@@ -14,6 +14,14 @@ type node struct {
 	parent      *node
 	left, right *node
 
+	// The number of nodes in the subtree rooted at this one, including itself.
+	// Always zero for nilChild.
+	size int
+
+	// The aggregate of the items in this subtree, if the tree was created by
+	// NewAggregated. See aggregate.go.
+	aug *augment
+
 	item Item
 }
 
@@ -28,6 +36,7 @@ func newRedNode(item Item) *node {
 		item:  item,
 		left:  nilChild,
 		right: nilChild,
+		size:  1,
 	}
 }
 
@@ -38,6 +47,7 @@ func newRedChildNode(item Item, parent *node) *node {
 		left:   nilChild,
 		right:  nilChild,
 		parent: parent,
+		size:   1,
 	}
 }
 
@@ -99,6 +109,13 @@ func rotateRightNoFixup(root *node) {
 	pivot.SetParent(root.Parent())
 	pivot.right = root
 	root.SetParent(pivot)
+
+	// Pivot now roots the subtree that root did, and root has lost pivot's
+	// left subtree
+	pivot.size = root.size
+	root.size = root.left.size + root.right.size + 1
+	root.updateAggregate()
+	pivot.updateAggregate()
 }
 
 // Same as rotateRightNoFixup, but rotates the right child of root counterclockwise.
@@ -114,6 +131,11 @@ func rotateLeftNoFixup(root *node) {
 	pivot.SetParent(root.Parent())
 	pivot.left = root
 	root.SetParent(pivot)
+
+	pivot.size = root.size
+	root.size = root.left.size + root.right.size + 1
+	root.updateAggregate()
+	pivot.updateAggregate()
 }
 
 // Performs step 3 of a rotation.
@@ -381,6 +403,12 @@ func deleteNode(x *node, treeRoot **node) (deleted Item) {
 		x = succ
 	}
 
+	// x is the node which will be unlinked, so each of its ancestors loses one
+	// node from its subtree. Rotations during the rebalance preserve the sizes.
+	for p := x.Parent(); p != nil; p = p.Parent() {
+		p.size -= 1
+	}
+
 	// x now has at most one non-leaf child
 	child := x.left
 	if !x.HasLeftChild() {
@@ -404,6 +432,10 @@ func deleteNode(x *node, treeRoot **node) (deleted Item) {
 		parent.right = child
 	}
 
+	// The aggregates of the ancestors of x no longer include its item, and the
+	// node holding the deleted item, if it survives, now holds that of x.
+	updateAggregatesFrom(parent)
+
 	// If x was a red node, we can replace it with its child without altering the number of
 	// black nodes in a path.
 	if x.IsRed() {
@@ -0,0 +1,32 @@
+package rbtree
+
+import "cmp"
+
+// A red-black tree whose values are unique and ordered by the < operator.
+//
+// Unlike Tree, an OrderedTree stores its values directly in its nodes instead
+// of boxing them in an Item, and compares them without an indirect call to
+// Less. Use Tree when a tree must hold items of several different types.
+//
+// OrderedTree has all the methods of FuncTree. Unlike a FuncTree, the zero
+// value is an empty tree ready to use.
+type OrderedTree[T cmp.Ordered] struct {
+	FuncTree[T]
+}
+
+// Returns a fully initialized red-black tree of values of type T.
+func NewOrdered[T cmp.Ordered]() OrderedTree[T] {
+	return OrderedTree[T]{NewFunc(cmp.Compare[T])}
+}
+
+// Inserts a value into the tree if it is not already present. Returns true if
+// the value was inserted, or false if a duplicate was found.
+//
+// Runs in O(log n) time.
+func (t *OrderedTree[T]) Insert(v T) bool {
+	if t.inner.cmp == nil {
+		t.inner.cmp = cmp.Compare[T]
+	}
+
+	return t.FuncTree.Insert(v)
+}
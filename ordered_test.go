@@ -0,0 +1,309 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Checks the red-black invariants of a funcTree and returns the black height of
+// the subtree rooted at n.
+func checkGenericSubtree[T any](t *testing.T, tree *funcTree[T], n *gnode[T]) int {
+	if n.isLeaf() {
+		if n != tree.leaf {
+			t.Fatalf("Leaf is not the tree's sentinel")
+		}
+		return 1
+	}
+
+	for _, child := range [2]*gnode[T]{n.left, n.right} {
+		if !child.isLeaf() && child.parent != n {
+			t.Fatalf("Child of %v has wrong parent", n.value)
+		}
+		if n.IsRed() && child.IsRed() {
+			t.Fatalf("Red node %v has a red child", n.value)
+		}
+	}
+
+	if n.HasLeftChild() && tree.cmp(n.left.value, n.value) >= 0 {
+		t.Fatalf("Left child of %v is out of order", n.value)
+	}
+	if n.HasRightChild() && tree.cmp(n.right.value, n.value) <= 0 {
+		t.Fatalf("Right child of %v is out of order", n.value)
+	}
+
+	left, right := checkGenericSubtree(t, tree, n.left), checkGenericSubtree(t, tree, n.right)
+	if left != right {
+		t.Fatalf("Black heights of children of %v differ: %d != %d", n.value, left, right)
+	}
+
+	if n.IsBlack() {
+		return left + 1
+	}
+	return left
+}
+
+func checkOrderedTree(t *testing.T, tree OrderedTree[int], expected []int) {
+	if tree.Size() != len(expected) {
+		t.Fatalf("Size is %d, expected %d", tree.Size(), len(expected))
+	}
+
+	if !tree.Empty() {
+		if tree.inner.root.IsRed() || !tree.inner.root.IsRoot() {
+			t.Fatalf("Root is red or has a parent")
+		}
+		checkGenericSubtree(t, &tree.inner, tree.inner.root)
+	}
+
+	i := 0
+	for it := tree.First(); it != tree.End(); it.Next() {
+		if i >= len(expected) || it.Value() != expected[i] {
+			t.Fatalf("Tree differs from %v at index %d", expected, i)
+		}
+		i += 1
+	}
+
+	i = len(expected)
+	for it := tree.Last(); it != tree.End(); it.Prev() {
+		i -= 1
+		if i < 0 || it.Value() != expected[i] {
+			t.Fatalf("Reversed tree differs from %v at index %d", expected, i)
+		}
+	}
+}
+
+func TestOrderedTree(t *testing.T) {
+	const N = 500
+	rng := rand.New(rand.NewSource(7))
+
+	var tree OrderedTree[int]
+	present := map[int]bool{}
+	sorted := func() []int {
+		s := make([]int, 0, len(present))
+		for v := range present {
+			s = append(s, v)
+		}
+		sort.Ints(s)
+		return s
+	}
+
+	for i := 0; i < 4*N; i++ {
+		v := rng.Intn(N)
+		if rng.Intn(3) == 0 {
+			if tree.Delete(v) != present[v] {
+				t.Fatalf("Delete(%d) disagreed with presence", v)
+			}
+			delete(present, v)
+		} else {
+			if tree.Insert(v) == present[v] {
+				t.Fatalf("Insert(%d) disagreed with presence", v)
+			}
+			present[v] = true
+		}
+
+		if i%50 == 0 {
+			checkOrderedTree(t, tree, sorted())
+		}
+	}
+	checkOrderedTree(t, tree, sorted())
+
+	for v := 0; v < N; v++ {
+		if it, ok := tree.Find(v); ok != present[v] || ok && it.Value() != v {
+			t.Fatalf("Find(%d) returned (%v, %v)", v, it.IsValid(), ok)
+		}
+	}
+
+	for _, v := range sorted() {
+		tree.Delete(v)
+	}
+	checkOrderedTree(t, tree, nil)
+}
+
+func TestOrderedTreeBounds(t *testing.T) {
+	tree := NewOrdered[string]()
+	for _, s := range []string{"b", "d", "f"} {
+		tree.Insert(s)
+	}
+
+	tests := []struct {
+		target       string
+		lower, upper string
+	}{
+		{"a", "b", "b"},
+		{"b", "b", "d"},
+		{"c", "d", "d"},
+		{"f", "f", ""},
+		{"g", "", ""},
+	}
+
+	value := func(it TypedIterator[string]) string {
+		if !it.IsValid() {
+			return ""
+		}
+		return it.Value()
+	}
+
+	for _, test := range tests {
+		if got := value(tree.LowerBound(test.target)); got != test.lower {
+			t.Errorf("LowerBound(%q) = %q, expected %q", test.target, got, test.lower)
+		}
+		if got := value(tree.UpperBound(test.target)); got != test.upper {
+			t.Errorf("UpperBound(%q) = %q, expected %q", test.target, got, test.upper)
+		}
+	}
+
+	if min, ok := tree.Min(); !ok || min != "b" {
+		t.Errorf("Min() = (%q, %v)", min, ok)
+	}
+	if max, ok := tree.Max(); !ok || max != "f" {
+		t.Errorf("Max() = (%q, %v)", max, ok)
+	}
+
+	tree.Clear()
+	if _, ok := tree.Min(); ok || !tree.Empty() || tree.First() != tree.End() {
+		t.Errorf("Cleared tree is not empty")
+	}
+}
+
+func TestFuncTree(t *testing.T) {
+	type point struct{ x, y int }
+
+	// Order points by x, then by descending y.
+	tree := NewFunc(func(a, b point) int {
+		if a.x != b.x {
+			return a.x - b.x
+		}
+		return b.y - a.y
+	})
+
+	for _, p := range []point{{1, 1}, {0, 5}, {1, 3}, {2, 0}, {1, 3}} {
+		tree.Insert(p)
+	}
+
+	expected := []point{{0, 5}, {1, 3}, {1, 1}, {2, 0}}
+	if tree.Size() != len(expected) {
+		t.Fatalf("Size is %d, expected %d", tree.Size(), len(expected))
+	}
+
+	i := 0
+	for it := tree.First(); it != tree.End(); it.Next() {
+		if it.Value() != expected[i] {
+			t.Errorf("Item %d is %v, expected %v", i, it.Value(), expected[i])
+		}
+		i += 1
+	}
+
+	if it := tree.LowerBound(point{1, 2}); !it.IsValid() || it.Value() != (point{1, 1}) {
+		t.Errorf("LowerBound returned the wrong point")
+	}
+	if it := tree.UpperBound(point{1, 3}); !it.IsValid() || it.Value() != (point{1, 1}) {
+		t.Errorf("UpperBound returned the wrong point")
+	}
+	if !tree.Delete(point{1, 3}) || tree.Delete(point{1, 3}) {
+		t.Errorf("Delete did not remove exactly one point")
+	}
+	if _, ok := tree.Find(point{1, 3}); ok {
+		t.Errorf("Found a deleted point")
+	}
+}
+
+// Build a large OrderedTree of random integers, for comparison with
+// BenchmarkRBInsert.
+func BenchmarkOrderedInsert(b *testing.B) {
+	ints := randRange(1<<16, 43)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree := NewOrdered[int]()
+		for _, n := range ints {
+			tree.Insert(int(n))
+		}
+	}
+}
+
+// Build a large OrderedTree of random integers, then delete every element one
+// by one, for comparison with BenchmarkRBDelete.
+func BenchmarkOrderedDelete(b *testing.B) {
+	ints := randRange(1<<16, 43)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree := NewOrdered[int]()
+		for _, n := range ints {
+			tree.Insert(int(n))
+		}
+		b.StartTimer()
+
+		for _, n := range ints {
+			tree.Delete(int(n))
+		}
+	}
+}
+
+// Look up every element of a large OrderedTree of random integers.
+func BenchmarkOrderedFind(b *testing.B) {
+	ints := randRange(1<<16, 43)
+	tree := NewOrdered[int]()
+	for _, n := range ints {
+		tree.Insert(int(n))
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Find(int(ints[i%len(ints)]))
+	}
+}
+
+// Look up every element of a large Tree of random integers, for comparison
+// with BenchmarkOrderedFind.
+func BenchmarkRBFind(b *testing.B) {
+	ints := randRange(1<<16, 43)
+	tree := New()
+	for _, n := range ints {
+		tree.Insert(n)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Find(ints[i%len(ints)])
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	var m OrderedMap[string, int]
+	for i, word := range []string{"pear", "apple", "fig", "apple", "kiwi"} {
+		m.Set(word, i)
+	}
+
+	if m.Len() != 4 {
+		t.Fatalf("Len is %d, expected 4", m.Len())
+	}
+	if v, ok := m.Get("apple"); !ok || v != 3 {
+		t.Errorf("Get(apple) = (%d, %v), expected the replaced value 3", v, ok)
+	}
+	if v, ok := m.Get("plum"); ok || v != 0 {
+		t.Errorf("Get(plum) = (%d, %v) for an absent key", v, ok)
+	}
+	if !m.Delete("fig") || m.Delete("fig") {
+		t.Errorf("Delete did not remove exactly one key")
+	}
+
+	var keys []string
+	var values []int
+	for k, v := range m.Range() {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	if !reflect.DeepEqual(keys, []string{"apple", "kiwi", "pear"}) || !reflect.DeepEqual(values, []int{3, 4, 0}) {
+		t.Errorf("Range yielded %v and %v", keys, values)
+	}
+
+	for k := range m.Range() {
+		if k != "apple" {
+			t.Errorf("Range continued after the loop broke")
+		}
+		break
+	}
+}
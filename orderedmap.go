@@ -0,0 +1,73 @@
+package rbtree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// An entry of an OrderedMap, ordered by its key alone so that an entry holding
+// only a key can be used to look up the full entry.
+type mapEntry[K cmp.Ordered, V any] struct {
+	key   K
+	value V
+}
+
+func (e mapEntry[K, V]) Less(than Item) bool {
+	return cmp.Less(e.key, than.(mapEntry[K, V]).key)
+}
+
+// A map whose keys are kept in ascending order, built on a Tree of entries
+// compared by key. It hides the boilerplate of defining an Item type whose
+// Less ignores its payload.
+//
+// The zero value is an empty map ready to use.
+type OrderedMap[K cmp.Ordered, V any] struct {
+	tree Tree
+}
+
+// Returns an empty ordered map.
+func NewOrderedMap[K cmp.Ordered, V any]() OrderedMap[K, V] {
+	return OrderedMap[K, V]{}
+}
+
+// Returns the number of keys in the map. Runs in O(1) time.
+func (m OrderedMap[K, V]) Len() int {
+	return m.tree.Size()
+}
+
+// Associates value with key, replacing any value the key already had.
+//
+// Runs in O(log n) time.
+func (m *OrderedMap[K, V]) Set(key K, value V) {
+	m.tree.InsertOrReplace(mapEntry[K, V]{key, value})
+}
+
+// Returns the value associated with key and true, or the zero value and false
+// if the key is not in the map.
+//
+// Runs in O(log n) time.
+func (m OrderedMap[K, V]) Get(key K) (value V, ok bool) {
+	if e := m.tree.FindItem(mapEntry[K, V]{key: key}); e != nil {
+		return e.(mapEntry[K, V]).value, true
+	}
+
+	return value, false
+}
+
+// Removes key from the map, returning true if it was present.
+//
+// Runs in O(log n) time.
+func (m *OrderedMap[K, V]) Delete(key K) bool {
+	return m.tree.Delete(mapEntry[K, V]{key: key}) != nil
+}
+
+// Returns an iterator over the keys and values of the map in ascending order
+// of key. The map must not be modified during the iteration.
+func (m OrderedMap[K, V]) Range() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.tree.ForEach(func(item Item) bool {
+			e := item.(mapEntry[K, V])
+			return yield(e.key, e.value)
+		})
+	}
+}
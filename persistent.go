@@ -0,0 +1,317 @@
+package rbtree
+
+// This file contains a persistent red-black tree, in which Insert and Delete
+// return a new version of the tree instead of modifying it. Nodes are never
+// modified after they are created, so each version shares every subtree off
+// the path to the inserted or deleted item with the version it came from.
+//
+// Sharing rules out parent pointers, so the balancing is done on the way back
+// up the recursion instead of by the loops in node.go. Insertion follows
+// Okasaki's "Red-Black Trees in a Functional Setting" (1999), and deletion
+// follows Kahrs' "Red-Black Trees with Types" (2001).
+
+// A node of a PersistentTree. Leaves are nil, and are black.
+type pnode struct {
+	black       bool
+	left, right *pnode
+
+	item Item
+}
+
+func (n *pnode) isRed() bool   { return n != nil && !n.black }
+func (n *pnode) isBlack() bool { return n != nil && n.black }
+
+func redP(left *pnode, item Item, right *pnode) *pnode {
+	return &pnode{left: left, item: item, right: right}
+}
+
+func blackP(left *pnode, item Item, right *pnode) *pnode {
+	return &pnode{black: true, left: left, item: item, right: right}
+}
+
+// Returns a black subtree with the given children and item, rebalancing it if
+// either child is red and has a red child. This is Okasaki's balance, plus the
+// case of two red children, which Kahrs' deletion requires.
+func balanceP(a *pnode, x Item, b *pnode) *pnode {
+	switch {
+	case a.isRed() && b.isRed():
+		return redP(blackP(a.left, a.item, a.right), x, blackP(b.left, b.item, b.right))
+	case a.isRed() && a.left.isRed():
+		return redP(blackP(a.left.left, a.left.item, a.left.right), a.item, blackP(a.right, x, b))
+	case a.isRed() && a.right.isRed():
+		return redP(blackP(a.left, a.item, a.right.left), a.right.item, blackP(a.right.right, x, b))
+	case b.isRed() && b.right.isRed():
+		return redP(blackP(a, x, b.left), b.item, blackP(b.right.left, b.right.item, b.right.right))
+	case b.isRed() && b.left.isRed():
+		return redP(blackP(a, x, b.left.left), b.left.item, blackP(b.left.right, b.item, b.right))
+	}
+
+	return blackP(a, x, b)
+}
+
+// Returns a copy of the subtree rooted at n with a black root.
+func blacken(n *pnode) *pnode {
+	if n.isRed() {
+		return blackP(n.left, n.item, n.right)
+	}
+
+	return n
+}
+
+// Returns the subtree rooted at n with item inserted, whose root may be red
+// with a red child. The subtree is returned unchanged if it contains an
+// equivalent item.
+func insertP(n *pnode, item Item) *pnode {
+	switch {
+	case n == nil:
+		return redP(nil, item, nil)
+	case item.Less(n.item):
+		if left := insertP(n.left, item); left != n.left {
+			if n.black {
+				return balanceP(left, n.item, n.right)
+			}
+			return redP(left, n.item, n.right)
+		}
+	case n.item.Less(item):
+		if right := insertP(n.right, item); right != n.right {
+			if n.black {
+				return balanceP(n.left, n.item, right)
+			}
+			return redP(n.left, n.item, right)
+		}
+	}
+
+	return n
+}
+
+// Returns the subtree rooted at n without the item equivalent to item, which
+// must be present. If the root of the subtree is black, the result has a black
+// height one less than the subtree.
+func deleteP(n *pnode, item Item) *pnode {
+	switch {
+	case item.Less(n.item):
+		if n.left.isBlack() {
+			return balanceLeftP(deleteP(n.left, item), n.item, n.right)
+		}
+		return redP(deleteP(n.left, item), n.item, n.right)
+	case n.item.Less(item):
+		if n.right.isBlack() {
+			return balanceRightP(n.left, n.item, deleteP(n.right, item))
+		}
+		return redP(n.left, n.item, deleteP(n.right, item))
+	default:
+		return fuseP(n.left, n.right)
+	}
+}
+
+// Returns a subtree with the given children and item, where the black height
+// of left is one less than that of right.
+func balanceLeftP(left *pnode, x Item, right *pnode) *pnode {
+	switch {
+	case left.isRed():
+		return redP(blackP(left.left, left.item, left.right), x, right)
+	case right.isBlack():
+		return balanceP(left, x, redP(right.left, right.item, right.right))
+	default:
+		// right is red, so its left child is black and not a leaf.
+		rl := right.left
+		return redP(blackP(left, x, rl.left), rl.item, balanceP(rl.right, right.item, redden(right.right)))
+	}
+}
+
+// Same as balanceLeftP, where the black height of right is one less than that
+// of left.
+func balanceRightP(left *pnode, x Item, right *pnode) *pnode {
+	switch {
+	case right.isRed():
+		return redP(left, x, blackP(right.left, right.item, right.right))
+	case left.isBlack():
+		return balanceP(redP(left.left, left.item, left.right), x, right)
+	default:
+		lr := left.right
+		return redP(balanceP(redden(left.left), left.item, lr.left), lr.item, blackP(lr.right, x, right))
+	}
+}
+
+// Returns a copy of n, which must be black and not a leaf, colored red.
+func redden(n *pnode) *pnode {
+	return redP(n.left, n.item, n.right)
+}
+
+// Returns a subtree holding the items of left followed by those of right,
+// which have the same black height, replacing their former parent.
+func fuseP(left, right *pnode) *pnode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.black && !right.black:
+		return redP(fuseP(left, right.left), right.item, right.right)
+	case !left.black && right.black:
+		return redP(left.left, left.item, fuseP(left.right, right))
+	}
+
+	middle := fuseP(left.right, right.left)
+	if !left.black {
+		if middle.isRed() {
+			return redP(redP(left.left, left.item, middle.left), middle.item, redP(middle.right, right.item, right.right))
+		}
+		return redP(left.left, left.item, redP(middle, right.item, right.right))
+	}
+
+	if middle.isRed() {
+		return redP(blackP(left.left, left.item, middle.left), middle.item, blackP(middle.right, right.item, right.right))
+	}
+	return balanceLeftP(left.left, left.item, blackP(middle, right.item, right.right))
+}
+
+// An immutable red-black tree of unique items. Insert and Delete return a new
+// version of the tree, leaving the receiver and every earlier version valid
+// and unchanged, which makes a PersistentTree useful for keeping a history of
+// states such as an undo stack. Each version shares all but O(log n) of its
+// nodes with the version it was made from.
+//
+// The zero value is an empty tree ready to use. Since versions never change,
+// they may be read by many goroutines at once.
+type PersistentTree struct {
+	root *pnode
+	size int
+}
+
+// Returns true if the number of items in the tree is zero
+func (t PersistentTree) Empty() bool {
+	return t.root == nil
+}
+
+// Returns the size of the tree. Runs in O(1) time.
+func (t PersistentTree) Size() int {
+	return t.size
+}
+
+// Returns the node holding the item equivalent to item, or nil if there is
+// none.
+func (t PersistentTree) find(item Item) *pnode {
+	if item == nil {
+		return nil
+	}
+
+	for n := t.root; n != nil; {
+		switch {
+		case item.Less(n.item):
+			n = n.left
+		case n.item.Less(item):
+			n = n.right
+		default:
+			return n
+		}
+	}
+
+	return nil
+}
+
+// Returns the item in the tree equivalent to item, or nil if there is none.
+//
+// Runs in O(log n) time.
+func (t PersistentTree) FindItem(item Item) Item {
+	if n := t.find(item); n != nil {
+		return n.item
+	}
+
+	return nil
+}
+
+// Returns true if the tree contains an item equivalent to item.
+//
+// Runs in O(log n) time.
+func (t PersistentTree) Contains(item Item) bool {
+	return t.find(item) != nil
+}
+
+// Returns the minimum value in the tree or nil if the tree is empty.
+//
+// Runs in O(log n) time.
+func (t PersistentTree) Min() Item {
+	if t.Empty() {
+		return nil
+	}
+
+	n := t.root
+	for n.left != nil {
+		n = n.left
+	}
+
+	return n.item
+}
+
+// Returns the maximum value in the tree or nil if the tree is empty.
+//
+// Runs in O(log n) time.
+func (t PersistentTree) Max() Item {
+	if t.Empty() {
+		return nil
+	}
+
+	n := t.root
+	for n.right != nil {
+		n = n.right
+	}
+
+	return n.item
+}
+
+// Returns a version of the tree with item inserted, and true, if an equivalent
+// item does not already exist. Otherwise, returns the receiver and false.
+//
+// Runs in O(log n) time.
+func (t PersistentTree) Insert(item Item) (PersistentTree, bool) {
+	if item == nil {
+		return t, false
+	}
+
+	root := insertP(t.root, item)
+	if root == t.root {
+		return t, false
+	}
+
+	return PersistentTree{root: blacken(root), size: t.size + 1}, true
+}
+
+// Returns a version of the tree without the item equivalent to item, and the
+// deleted item. If there is no such item, returns the receiver and nil.
+//
+// Runs in O(log n) time.
+func (t PersistentTree) Delete(item Item) (PersistentTree, Item) {
+	n := t.find(item)
+	if n == nil {
+		return t, nil
+	}
+
+	return PersistentTree{root: blacken(deleteP(t.root, item)), size: t.size - 1}, n.item
+}
+
+// Calls fn on each item in the tree in ascending order, stopping early if fn
+// returns false.
+//
+// Runs in O(n) time.
+func (t PersistentTree) ForEach(fn func(Item) bool) {
+	forEachP(t.root, fn)
+}
+
+func forEachP(n *pnode, fn func(Item) bool) bool {
+	return n == nil || forEachP(n.left, fn) && fn(n.item) && forEachP(n.right, fn)
+}
+
+// Returns a slice containing every item in the tree in ascending order. The
+// slice is empty but not nil if the tree is empty.
+//
+// Runs in O(n) time.
+func (t PersistentTree) ToSlice() []Item {
+	items := make([]Item, 0, t.size)
+	t.ForEach(func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+
+	return items
+}
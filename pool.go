@@ -0,0 +1,78 @@
+package rbtree
+
+// Returns a red-black tree which recycles the nodes of deleted items for later
+// insertions instead of leaving them to the garbage collector. This reduces
+// allocations in workloads which insert and delete many items; Clear releases
+// the recycled nodes.
+//
+// Since a node may be reused as soon as its item is deleted, an Iterator to a
+// deleted item may silently point to an unrelated item in a pooled tree,
+// rather than causing a panic.
+func NewPooled() Tree {
+	return Tree{inner: tree{pooled: true}}
+}
+
+// Ensures that the next n insertions into a tree created by NewPooled take
+// their nodes from the free list instead of allocating them, by allocating the
+// missing nodes all at once, like the capacity of a slice. Reserve does nothing
+// if the tree is not pooled. Since Clear empties the free list, it also
+// releases the reserved nodes.
+//
+// The nodes are allocated as a single block, which the garbage collector can
+// only reclaim once none of them is in use.
+//
+// Runs in O(n) time.
+func (t *Tree) Reserve(n int) {
+	t.inner.reserve(n)
+}
+
+func (t *tree) reserve(n int) {
+	if !t.pooled {
+		return
+	}
+
+	for f := t.free; f != nil && n > 0; f = f.right {
+		n -= 1
+	}
+
+	if n <= 0 {
+		return
+	}
+
+	block := make([]node, n)
+	for i := range block {
+		t.release(&block[i])
+	}
+}
+
+// Returns a new red node holding item with the given parent, reusing a node
+// from the free list if there is one.
+func (t *tree) newNode(item Item, parent *node) *node {
+	n := t.free
+	if n == nil {
+		n = newRedChildNode(item, parent)
+	} else {
+		t.free = n.right
+		*n = node{
+			item:   item,
+			left:   nilChild,
+			right:  nilChild,
+			parent: parent,
+			size:   1,
+		}
+	}
+
+	if t.monoid != nil {
+		n.aug = &augment{monoid: t.monoid}
+		n.updateAggregate()
+	}
+
+	return n
+}
+
+// Adds a node which has been unlinked from the tree to the free list, clearing
+// it so that it doesn't keep its item or its former neighbors alive.
+func (t *tree) release(n *node) {
+	*n = node{right: t.free}
+	t.free = n
+}
@@ -0,0 +1,249 @@
+package rbtree
+
+import "reflect"
+
+// Returns true if no item in a is equivalent to an item in b.
+//
+// Runs in O(n + m) time, stopping as soon as a common item is found.
+func Disjoint(a, b Tree) bool {
+	x, y := a.inner.First().node, b.inner.First().node
+	for x != nil && y != nil {
+		switch {
+		case x.item.Less(y.item):
+			x = successor(x)
+		case y.item.Less(x.item):
+			y = successor(y)
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns true if every item in the tree is equivalent to an item in other.
+//
+// Runs in O(n + m) time, stopping as soon as an item missing from other is
+// found.
+func (t Tree) IsSubsetOf(other Tree) bool {
+	if t.Size() > other.Size() {
+		return false
+	}
+
+	x, y := t.inner.First().node, other.inner.First().node
+	for x != nil {
+		switch {
+		case y == nil || x.item.Less(y.item):
+			return false
+		case y.item.Less(x.item):
+			y = successor(y)
+		default:
+			x, y = successor(x), successor(y)
+		}
+	}
+
+	return true
+}
+
+// Returns true if every item in other is equivalent to an item in the tree.
+//
+// Runs in O(n + m) time.
+func (t Tree) IsSupersetOf(other Tree) bool {
+	return other.IsSubsetOf(t)
+}
+
+// Returns the longest run of items which are consecutive in both a and b, in
+// order. That is, the items of the run are present in both trees, and neither
+// tree contains any other item between the first and last item of the run. If
+// several runs have the same length, the smallest is returned. The items are
+// taken from a.
+//
+// Runs in O(n + m) time.
+func LongestCommonRun(a, b Tree) []Item {
+	var best, run []Item
+
+	x, y := a.inner.First().node, b.inner.First().node
+	for x != nil && y != nil {
+		switch {
+		case x.item.Less(y.item):
+			x, run = successor(x), nil
+		case y.item.Less(x.item):
+			y, run = successor(y), nil
+		default:
+			run = append(run, x.item)
+			if len(run) > len(best) {
+				best = run
+			}
+
+			x, y = successor(x), successor(y)
+		}
+	}
+
+	return best
+}
+
+// Returns a tree containing the items which are present in exactly one of the
+// given trees.
+//
+// Runs in O(k * N) time, where k is the number of trees and N is their total
+// size.
+func UniqueAcross(trees ...Tree) Tree {
+	cursors := make([]*node, 0, len(trees))
+	for _, t := range trees {
+		if n := t.inner.First().node; n != nil {
+			cursors = append(cursors, n)
+		}
+	}
+
+	var result Tree
+	for len(cursors) > 0 {
+		// Find the smallest item under any cursor.
+		least := cursors[0].item
+		for _, n := range cursors[1:] {
+			if n.item.Less(least) {
+				least = n.item
+			}
+		}
+
+		// Advance every cursor pointing to an equivalent item, dropping those
+		// which reach the end of their tree.
+		count, i := 0, 0
+		for _, n := range cursors {
+			if !least.Less(n.item) {
+				count += 1
+				n = successor(n)
+			}
+
+			if n != nil {
+				cursors[i] = n
+				i += 1
+			}
+		}
+
+		cursors = cursors[:i]
+		if count == 1 {
+			result.inner.append(least)
+		}
+	}
+
+	return result
+}
+
+// Returns the smallest item at which a and b differ, along with true. The trees
+// differ at an item if it is present in only one of them, or if the
+// equivalent items in each tree are not deeply equal (as reported by
+// reflect.DeepEqual), which detects items with the same key but different
+// payloads. In the latter case, the item from a is returned. Returns false if
+// the trees are identical.
+//
+// Runs in O(n + m) time, stopping at the first difference.
+func FirstDivergence(a, b Tree) (Item, bool) {
+	x, y := a.inner.First().node, b.inner.First().node
+	for x != nil && y != nil {
+		switch {
+		case x.item.Less(y.item):
+			return x.item, true
+		case y.item.Less(x.item):
+			return y.item, true
+		case !reflect.DeepEqual(x.item, y.item):
+			return x.item, true
+		}
+
+		x, y = successor(x), successor(y)
+	}
+
+	switch {
+	case x != nil:
+		return x.item, true
+	case y != nil:
+		return y.item, true
+	default:
+		return nil, false
+	}
+}
+
+// Merge-walks a and b, appending to the result the items of a which are not in
+// b, the items common to both (taken from a), and the items of b which are not
+// in a, when the corresponding flag is set. The result is built directly from
+// the sorted items.
+func combine(a, b Tree, onlyA, both, onlyB bool) Tree {
+	var items []Item
+	x, y := a.inner.First().node, b.inner.First().node
+	for x != nil || y != nil {
+		switch {
+		case y == nil || x != nil && x.item.Less(y.item):
+			if onlyA {
+				items = append(items, x.item)
+			}
+			x = successor(x)
+		case x == nil || y.item.Less(x.item):
+			if onlyB {
+				items = append(items, y.item)
+			}
+			y = successor(y)
+		default:
+			if both {
+				items = append(items, x.item)
+			}
+			x, y = successor(x), successor(y)
+		}
+	}
+
+	return Tree{inner: buildSorted(items)}
+}
+
+// Returns a tree containing the items which are in a, b, or both. When a and b
+// contain equivalent items, the one from a is kept.
+//
+// Runs in O(n + m) time.
+func SetUnion(a, b Tree) Tree {
+	return combine(a, b, true, true, true)
+}
+
+// Returns a tree containing the items of a which are equivalent to an item in
+// b.
+//
+// Runs in O(n + m) time.
+func SetIntersection(a, b Tree) Tree {
+	return combine(a, b, false, true, false)
+}
+
+// Returns a tree containing the items of a which are not equivalent to any
+// item in b.
+//
+// Runs in O(n + m) time.
+func SetDifference(a, b Tree) Tree {
+	return combine(a, b, true, false, false)
+}
+
+// Returns true if the in-order items of a and b are equivalent one for one.
+func equalTrees(a, b tree) bool {
+	if a.size != b.size {
+		return false
+	}
+
+	for x, y := a.min, b.min; x != nil; x, y = successor(x), successor(y) {
+		if !equivalent(x.item, y.item) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns true if a and b contain equivalent items, regardless of the shapes of
+// the trees. Items are compared with Less, so unlike FirstDivergence, Equal
+// ignores any payload which does not affect the ordering.
+//
+// Runs in O(n) time, or O(1) time if the sizes of the trees differ.
+func Equal(a, b Tree) bool {
+	return equalTrees(a.inner, b.inner)
+}
+
+// Same as Equal, but for multi-valued trees, which are only equal if they
+// contain the same number of copies of each item.
+//
+// Runs in O(n) time, or O(1) time if the sizes of the trees differ.
+func EqualMultiValued(a, b MultiValuedTree) bool {
+	return equalTrees(a.inner, b.inner)
+}
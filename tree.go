@@ -19,9 +19,24 @@
 // do so efficiently.
 package rbtree
 
+import "math/bits"
+
 type tree struct {
 	root *node
 	size int
+
+	// The nodes holding the minimum and maximum items, so that Min and Max
+	// don't need to descend the tree.
+	min, max *node
+
+	// If pooled is true, removed nodes are kept in a free list linked through
+	// their right pointers, and reused by later insertions. See NewPooled.
+	pooled bool
+	free   *node
+
+	// The aggregate maintained in every node, or nil if the tree was not
+	// created by NewAggregated.
+	monoid *monoid
 }
 
 // Returns true if the number of items in the tree is zero
@@ -30,24 +45,24 @@ func (t tree) Empty() bool {
 }
 
 // Returns the minimum value in the tree or nil if the tree is empty.
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t tree) Min() Item {
 	if t.Empty() {
 		return nil
 	}
 
-	return min(t.root).item
+	return t.min.item
 }
 
 // Returns the maximum value in the tree or nil if the tree is empty.
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t tree) Max() Item {
 	if t.Empty() {
 		return nil
 	}
 
-	return max(t.root).item
+	return t.max.item
 }
 
 func (t tree) Size() int {
@@ -55,85 +70,189 @@ func (t tree) Size() int {
 }
 
 func (t tree) Find(item Item) (Iterator, bool) {
+	if item == nil {
+		return t.End(), false
+	}
+
 	if n, ord := get(t.root, item); ord == equalTo {
-		return Iterator{n}, true
+		return t.iterAt(n), true
 	} else {
 		return t.End(), false
 	}
 }
 
+// Returns true if the tree contains an item equivalent to item.
+func (t tree) Contains(item Item) bool {
+	if t.Empty() || item == nil {
+		return false
+	}
+
+	_, ord := get(t.root, item)
+	return ord == equalTo
+}
+
 func (t *tree) Insert(item Item) {
-	n := newRedNode(item)
-	t.size += 1
+	if item == nil {
+		return
+	}
 
 	if t.Empty() {
-		n.SetBlack()
-		t.root = n
+		t.insertAt(item, nil, equalTo)
 		return
 	}
 
 	// The choice between rightmost and leftmost is arbitrary
 	// TODO: benchmark?
 	place, ord := getRightmostInsertionPoint(t.root, item)
-	n.SetParent(place)
 
 	// We know that place.item == item implies place.hasRightChild() == false
 	// because otherwise getRightmostInsertionPoint would have continued to the
 	// right.
-	switch ord {
-	case greaterThan, equalTo:
-		place.right = n
-	case lessThan:
-		place.left = n
-	}
-
-	balanceAfterInsert(n, &t.root)
+	t.insertAt(item, place, ord)
 }
 
 // Tries to insert a unique item into the tree. If the item already exists in the
 // tree, does nothing and returns a pointer to the highest node in the
-// hierarchy with the same item.
-func (t *tree) insertUniqueOrReturnPlace(item Item) *node {
+// hierarchy with the same item. Otherwise, returns the newly inserted node.
+// The boolean return value is true if the item was inserted.
+//
+// A nil item is never inserted, and the returned node is nil.
+func (t *tree) insertUnique(item Item) (*node, bool) {
+	if item == nil {
+		return nil, false
+	}
+
 	if t.Empty() {
-		n := newRedNode(item)
-		n.SetBlack()
-		t.size += 1
-		t.root = n
-		return nil
+		return t.insertAt(item, nil, equalTo), true
 	}
 
 	place, ord := get(t.root, item)
 	if ord == equalTo {
-		return place
+		return place, false
 	}
 
-	n := newRedChildNode(item, place)
+	return t.insertAt(item, place, ord), true
+}
+
+// Same as insertUnique, but first checks whether the item belongs immediately
+// before or after hint, which may be nil to stand for the end of the tree, and
+// if so links it there without searching from the root.
+func (t *tree) insertHint(hint *node, item Item) (*node, bool) {
+	switch {
+	case item == nil:
+		return nil, false
+
+	case t.Empty():
+		return t.insertAt(item, nil, equalTo), true
+
+	case hint == nil:
+		if t.max.item.Less(item) {
+			return t.append(item), true
+		}
+
+	case item.Less(hint.item):
+		var pred *node
+		if hint != t.min {
+			pred = predecessor(hint)
+		}
+
+		if pred == nil || pred.item.Less(item) {
+			if !hint.HasLeftChild() {
+				return t.insertAt(item, hint, lessThan), true
+			}
+
+			return t.insertAt(item, pred, greaterThan), true
+		}
+
+	case hint.item.Less(item):
+		var succ *node
+		if hint != t.max {
+			succ = successor(hint)
+		}
+
+		if succ == nil || item.Less(succ.item) {
+			if !hint.HasRightChild() {
+				return t.insertAt(item, hint, greaterThan), true
+			}
+
+			return t.insertAt(item, succ, lessThan), true
+		}
+
+	default:
+		return hint, false
+	}
+
+	return t.insertUnique(item)
+}
+
+// Inserts an item which is greater than or equal to every item in the tree,
+// without searching for its position.
+func (t *tree) append(item Item) *node {
+	return t.insertAt(item, t.max, greaterThan)
+}
+
+// Inserts a new node holding item as a child of place and rebalances the
+// tree, returning the new node. The node becomes the left child of place if
+// ord is lessThan and the right child otherwise; that child must be a leaf. If
+// the tree is empty, place is ignored and the new node becomes the root.
+func (t *tree) insertAt(item Item, place *node, ord ordering) *node {
+	if t.Empty() {
+		n := t.newNode(item, nil)
+		n.SetBlack()
+		t.size += 1
+		t.root = n
+		t.min, t.max = n, n
+		return n
+	}
+
+	n := t.newNode(item, place)
 	t.size += 1
+	for p := place; p != nil; p = p.Parent() {
+		p.size += 1
+	}
 	switch ord {
-	case greaterThan:
+	case greaterThan, equalTo:
 		place.right = n
+		if place == t.max {
+			t.max = n
+		}
 	case lessThan:
 		place.left = n
+		if place == t.min {
+			t.min = n
+		}
 	}
 
+	updateAggregatesFrom(n)
 	balanceAfterInsert(n, &t.root)
-	return nil
+	return n
 }
 
 // InsertUnique inserts an item into a tree and returns true if an
 // equivalent item does not already exist. If an equivalent item does
 // exist, InsertUnique returns false and does not modify the tree.
 func (t *tree) InsertUnique(item Item) bool {
-	return t.insertUniqueOrReturnPlace(item) == nil
+	_, inserted := t.insertUnique(item)
+	return inserted
 }
 
 func (t *tree) InsertOrReplace(item Item) Item {
-	if place := t.insertUniqueOrReturnPlace(item); place != nil {
+	old, _ := t.insertOrReplace(item)
+	return old
+}
+
+// Inserts an item, or replaces an equivalent one, returning the replaced item
+// (or nil) and the node now holding the new item.
+func (t *tree) insertOrReplace(item Item) (Item, *node) {
+	if place, inserted := t.insertUnique(item); place == nil {
+		return nil, nil
+	} else if !inserted {
 		// Swap the old item for the new
 		item, place.item = place.item, item
-		return item
+		updateAggregatesFrom(place)
+		return item, place
 	} else {
-		return nil
+		return nil, place
 	}
 }
 
@@ -141,19 +260,121 @@ func (t *tree) InsertOrReplace(item Item) Item {
 func (t *tree) Clear() {
 	t.size = 0
 	t.root = nil
+	t.min, t.max = nil, nil
+	t.free = nil
 }
 
 // Delete looks for an item equivalent to target in the tree and deletes
 // it, returning the value that was present in the tree. If no item was found,
 // Delete returns nil and does not modify the tree.
 func (t *tree) Delete(item Item) Item {
+	item, _ = t.DeleteOK(item)
+	return item
+}
+
+// Same as Delete, but also returns a boolean indicating whether an item was
+// found.
+func (t *tree) DeleteOK(item Item) (Item, bool) {
+	if t.Empty() || item == nil {
+		return nil, false
+	}
+
 	n, ord := get(t.root, item)
 	if ord != equalTo {
+		return nil, false
+	}
+
+	return t.remove(n), true
+}
+
+// Removes every item for which pred returns true in a single ascending pass,
+// returning the number removed.
+func (t *tree) removeIf(pred func(Item) bool) int {
+	removed := 0
+	for n := t.min; n != nil; {
+		if pred(n.item) {
+			n = t.removeAt(n, false).node
+			removed += 1
+		} else {
+			n = successor(n)
+		}
+	}
+
+	return removed
+}
+
+// Removes the minimum item from the tree and returns it, or returns nil if the
+// tree is empty.
+func (t *tree) PopMin() Item {
+	if t.Empty() {
 		return nil
 	}
 
-	item = deleteNode(n, &t.root)
+	return t.remove(t.min)
+}
+
+// Removes the maximum item from the tree and returns it, or returns nil if the
+// tree is empty.
+func (t *tree) PopMax() Item {
+	if t.Empty() {
+		return nil
+	}
+
+	return t.remove(t.max)
+}
+
+// Removes the node n from the tree, and returns an Iterator to the item which
+// followed it, stepping backwards if reversed is true.
+func (t *tree) removeAt(n *node, reversed bool) Iterator {
+	var next *node
+	switch {
+	case reversed:
+		next = predecessor(n)
+	case n.HasLeftChild() && n.HasRightChild():
+		// deleteNode moves the item of the successor into n and unlinks the
+		// successor's node instead.
+		next = n
+	default:
+		next = successor(n)
+	}
+
+	t.remove(n)
+	it := t.iterAt(next)
+	it.reversed = reversed
+	return it
+}
+
+// Removes the node n from the tree, returning its item.
+func (t *tree) remove(n *node) Item {
+	// Find the new extremes before n is unlinked. If n has two children,
+	// deleteNode moves the item of its successor into n and unlinks the
+	// successor instead, so n takes over as the maximum if the successor was
+	// the maximum. Neither the minimum nor the maximum can have two children.
+	first, last := t.min, t.max
+	if n == first {
+		first = successor(n)
+	}
+
+	if n == last {
+		last = predecessor(n)
+	} else if n.HasLeftChild() && n.HasRightChild() && min(n.right) == last {
+		last = n
+	}
+
+	var unlinked *node
+	if t.pooled {
+		unlinked = n
+		if n.HasLeftChild() && n.HasRightChild() {
+			unlinked = min(n.right)
+		}
+	}
+
+	item := deleteNode(n, &t.root)
 	t.size -= 1
+	t.min, t.max = first, last
+	if unlinked != nil {
+		t.release(unlinked)
+	}
 
 	// If we deleted the last element in the tree, we now have nilChild as the root pointer.
 	if t.root == nilChild {
@@ -165,34 +386,43 @@ func (t *tree) Delete(item Item) Item {
 
 // Returns an Iterator pointing to the first item in the tree,
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t tree) First() Iterator {
 	if t.Empty() {
 		return t.End()
 	} else {
-		return Iterator{min(t.root)}
+		return t.iterAt(t.min)
 	}
 }
 
 // Returns an Iterator pointing to the last item in the tree.
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t tree) Last() Iterator {
 	if t.Empty() {
 		return t.End()
 	} else {
-		return Iterator{max(t.root)}
+		return t.iterAt(t.max)
 	}
 }
 
 // Returns an invalid Iterator pointing one past the beginning/end of
-// the tree. (it != tree.End()) implies it.IsValid().
+// the tree. !it.Equal(tree.End()) implies it.IsValid().
 func (t tree) End() Iterator {
-	return Iterator{nil}
+	return t.iterAt(nil)
+}
+
+// Returns an Iterator pointing to n, which must be a node of the tree or nil.
+func (t tree) iterAt(n *node) Iterator {
+	return Iterator{node: n, root: t.root}
 }
 
 // Returns an Iterator pointing to the first item greater than or equal to target.
 func (t tree) LowerBound(target Item) Iterator {
+	if t.Empty() || target == nil {
+		return t.End()
+	}
+
 	n, ord := getLeftmostInsertionPoint(t.root, target)
 
 	// If the target is greater than the insertion point, we actually want the
@@ -201,11 +431,15 @@ func (t tree) LowerBound(target Item) Iterator {
 		n = successor(n)
 	}
 
-	return Iterator{n}
+	return t.iterAt(n)
 }
 
 // Returns an Iterator pointing to the first item greater than target.
 func (t tree) UpperBound(target Item) Iterator {
+	if t.Empty() || target == nil {
+		return t.End()
+	}
+
 	n, ord := getRightmostInsertionPoint(t.root, target)
 
 	// If the target is greater than or equal to the insertion point, we
@@ -214,5 +448,334 @@ func (t tree) UpperBound(target Item) Iterator {
 		n = successor(n)
 	}
 
-	return Iterator{n}
+	return t.iterAt(n)
+}
+
+// Returns true if the in-order items of the tree are equivalent, one for one,
+// to the given slice. A nil element matches no item.
+func (t tree) MatchesSlice(items []Item) bool {
+	if t.size != len(items) {
+		return false
+	}
+
+	i := 0
+	for it := t.First(); it.IsValid(); it.Next() {
+		if items[i] == nil || !equivalent(it.Item(), items[i]) {
+			return false
+		}
+
+		i += 1
+	}
+
+	return true
+}
+
+// Returns the node holding the largest item less than or equal to target, or
+// nil if there is none.
+func (t tree) floor(target Item) *node {
+	if t.Empty() || target == nil {
+		return nil
+	}
+
+	n, ord := getRightmostInsertionPoint(t.root, target)
+
+	// If the target is less than the insertion point, we actually want the
+	// predecessor of the node.
+	if ord == lessThan {
+		n = predecessor(n)
+	}
+
+	return n
+}
+
+// Returns the node holding the smallest item greater than or equal to target,
+// or nil if there is none.
+func (t tree) ceiling(target Item) *node {
+	if t.Empty() || target == nil {
+		return nil
+	}
+
+	return t.LowerBound(target).node
+}
+
+// Returns the nodes which LowerBound and UpperBound would point to, finding
+// both in a single descent which only divides once it reaches an item
+// equivalent to target.
+func (t tree) equalRange(target Item) (lo, hi *node) {
+	if target == nil {
+		return nil, nil
+	}
+
+	for n := t.root; n != nil && n != nilChild; {
+		switch {
+		case n.item.Less(target):
+			n = n.right
+		case target.Less(n.item):
+			hi, n = n, n.left
+		default:
+			// n lies in the equal range, so the lower bound is in its left
+			// subtree (or is n itself) and the upper bound in its right.
+			lo = n
+			for l := n.left; l != nilChild; {
+				if l.item.Less(target) {
+					l = l.right
+				} else {
+					lo, l = l, l.left
+				}
+			}
+
+			for r := n.right; r != nilChild; {
+				if target.Less(r.item) {
+					hi, r = r, r.left
+				} else {
+					r = r.right
+				}
+			}
+
+			return lo, hi
+		}
+	}
+
+	return hi, hi
+}
+
+// Returns the node holding the smallest item greater than target, or nil if
+// there is none.
+func (t tree) successorOf(target Item) *node {
+	if t.Empty() || target == nil {
+		return nil
+	}
+
+	// The rightmost insertion point is either the successor itself, or the
+	// last node not greater than target.
+	n, ord := getRightmostInsertionPoint(t.root, target)
+	if ord != lessThan {
+		n = successor(n)
+	}
+
+	return n
+}
+
+// Returns the node holding the largest item less than target, or nil if there
+// is none.
+func (t tree) predecessorOf(target Item) *node {
+	if t.Empty() || target == nil {
+		return nil
+	}
+
+	n, ord := getLeftmostInsertionPoint(t.root, target)
+	if ord != greaterThan {
+		n = predecessor(n)
+	}
+
+	return n
+}
+
+// Returns the number of items in the tree which are less than target.
+func (t tree) rank(target Item) int {
+	if target == nil {
+		return 0
+	}
+
+	r := 0
+	for n := t.root; n != nil && n != nilChild; {
+		if n.item.Less(target) {
+			r += n.left.size + 1
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	return r
+}
+
+// Returns the number of items in the tree which are equivalent to target.
+func (t tree) count(target Item) int {
+	if target == nil {
+		return 0
+	}
+
+	notGreater := 0
+	for n := t.root; n != nil && n != nilChild; {
+		if !target.Less(n.item) {
+			notGreater += n.left.size + 1
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	return notGreater - t.rank(target)
+}
+
+// Returns the node holding the kth smallest item in the tree, counting from
+// zero, or nil if k is out of range.
+func (t tree) selectNode(k int) *node {
+	if k < 0 || k >= t.size {
+		return nil
+	}
+
+	n := t.root
+	for {
+		switch left := n.left.size; {
+		case k < left:
+			n = n.left
+		case k > left:
+			k -= left + 1
+			n = n.right
+		default:
+			return n
+		}
+	}
+}
+
+// Calls fn on the items from begin up to but not including end, stepping
+// backwards if reversed is true, until fn returns false.
+func forEachRange(begin, end *node, reversed bool, fn func(Item) bool) {
+	for n := begin; n != end; {
+		if !fn(n.item) {
+			return
+		}
+
+		if reversed {
+			n = predecessor(n)
+		} else {
+			n = successor(n)
+		}
+	}
+}
+
+// Returns the items of the tree in ascending order. The slice is never nil.
+func (t tree) ToSlice() []Item {
+	items := make([]Item, 0, t.size)
+	if !t.Empty() {
+		items = appendSubtree(items, t.root)
+	}
+
+	return items
+}
+
+// Appends the items in the subtree rooted at n to items in order.
+func appendSubtree(items []Item, n *node) []Item {
+	for n != nilChild {
+		items = appendSubtree(items, n.left)
+		items = append(items, n.item)
+		n = n.right
+	}
+
+	return items
+}
+
+// Returns a tree containing the given items, which must be sorted in ascending
+// order, without comparing any of them. The tree is as balanced as possible:
+// every level is full except the deepest, whose nodes are colored red so that
+// every path contains the same number of black nodes.
+func buildSorted(items []Item) tree {
+	if len(items) == 0 {
+		return tree{}
+	}
+
+	deepest := bits.Len(uint(len(items))) - 1
+	t := tree{size: len(items)}
+	t.root = buildSubtree(items, nil, 0, deepest)
+	t.root.SetBlack()
+	t.min, t.max = min(t.root), max(t.root)
+	return t
+}
+
+// Returns a tree containing the given items, discarding duplicates. If the
+// items are already sorted and unique, as they are when decoding an encoded
+// tree, the tree is built in O(n) time with buildSorted.
+func buildDecoded(items []Item) tree {
+	for i := 1; i < len(items); i++ {
+		if !items[i-1].Less(items[i]) {
+			var t tree
+			for _, item := range items {
+				t.InsertUnique(item)
+			}
+
+			return t
+		}
+	}
+
+	return buildSorted(items)
+}
+
+// Replaces the items of t with those of u, which must be a newly built tree,
+// keeping the configuration of t: whether it is pooled, along with its free
+// list, and its monoid.
+func (t *tree) replaceWith(u tree) {
+	u.pooled, u.free = t.pooled, t.free
+	u.setMonoid(t.monoid)
+	*t = u
+}
+
+// Builds a subtree with the parent p from the middle of items, whose root is at
+// the given depth of the tree.
+func buildSubtree(items []Item, p *node, depth, deepest int) *node {
+	if len(items) == 0 {
+		return nilChild
+	}
+
+	mid := len(items) / 2
+	n := &node{
+		black:  depth != deepest,
+		parent: p,
+		size:   len(items),
+		item:   items[mid],
+	}
+	n.left = buildSubtree(items[:mid], n, depth+1, deepest)
+	n.right = buildSubtree(items[mid+1:], n, depth+1, deepest)
+	return n
+}
+
+// Returns a deep copy of the tree which shares no nodes with the original.
+func (t tree) clone() tree {
+	if t.Empty() {
+		return tree{pooled: t.pooled, monoid: t.monoid}
+	}
+
+	c := tree{size: t.size, pooled: t.pooled, monoid: t.monoid}
+	c.root = cloneSubtree(t.root, nil, &t, &c)
+	return c
+}
+
+// Copies the subtree rooted at n, giving the copy the parent p. While copying,
+// records the copies of the minimum and maximum nodes of src in dst.
+func cloneSubtree(n, p *node, src, dst *tree) *node {
+	if n == nilChild {
+		return nilChild
+	}
+
+	c := &node{black: n.black, parent: p, size: n.size, item: n.item}
+	if n.aug != nil {
+		c.aug = &augment{value: n.aug.value, monoid: n.aug.monoid}
+	}
+	c.left = cloneSubtree(n.left, c, src, dst)
+	c.right = cloneSubtree(n.right, c, src, dst)
+
+	if n == src.min {
+		dst.min = c
+	}
+
+	if n == src.max {
+		dst.max = c
+	}
+
+	return c
+}
+
+// Returns the number of nodes on the longest path from n to a leaf, counting n.
+func height(n *node) int {
+	if n == nilChild {
+		return 0
+	}
+
+	l, r := height(n.left), height(n.right)
+	if l > r {
+		return l + 1
+	}
+
+	return r + 1
 }
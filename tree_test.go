@@ -1,10 +1,20 @@
 package rbtree
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func ExampleTree_Insert() {
@@ -160,6 +170,10 @@ func checkTree(t *testing.T, tree tree, members []int) {
 	}
 
 	checkTreeInvariants(t, tree.root)
+	checkExtremes(t, tree)
+	if nilChild.size != 0 {
+		t.Errorf("nilChild has a nonzero size")
+	}
 	if t.Failed() {
 		t.FailNow()
 	}
@@ -215,6 +229,10 @@ func checkTreeInvariants(t *testing.T, x *node) {
 			blackAncestors += 1
 		}
 
+		if x.size != x.left.size+x.right.size+1 {
+			t.Errorf("Subtree size is out of date")
+		}
+
 		for _, child := range x.Children() {
 			if child == nilChild {
 				// Leaf node
@@ -241,6 +259,56 @@ func checkTreeInvariants(t *testing.T, x *node) {
 	check(x, 0)
 }
 
+// Checks that the cached minimum and maximum nodes are correct
+func checkExtremes(t *testing.T, tree tree) {
+	if tree.Empty() {
+		if tree.min != nil || tree.max != nil {
+			t.Errorf("Empty tree has a cached minimum or maximum")
+		}
+
+		return
+	}
+
+	if tree.min != min(tree.root) {
+		t.Errorf("Cached minimum is not the leftmost node")
+	}
+
+	if tree.max != max(tree.root) {
+		t.Errorf("Cached maximum is not the rightmost node")
+	}
+}
+
+func TestDeleteExtremes(t *testing.T) {
+	rand.Seed(44)
+
+	tree := New()
+	members := make([]int, 0)
+	for _, i := range rand.Perm(1000) {
+		tree.Insert(Int(i))
+		members = append(members, i)
+	}
+
+	// Alternate between deleting the current minimum and maximum.
+	for i := 0; !tree.Empty(); i++ {
+		var item Item
+		if i%2 == 0 {
+			item = tree.Delete(tree.Min())
+			sort.Ints(members)
+			members = members[1:]
+		} else {
+			item = tree.Delete(tree.Max())
+			sort.Ints(members)
+			members = members[:len(members)-1]
+		}
+
+		if item == nil {
+			t.Fatal("Failed to delete an extreme item")
+		}
+
+		checkTree(t, tree.inner, members)
+	}
+}
+
 func TestSuccessorPredecessor(t *testing.T) {
 	tree := New()
 	tree.Insert(Int(3))
@@ -278,48 +346,3449 @@ func assertRangeEq(t *testing.T, begin, end Iterator, expected []int) {
 	}
 }
 
-// Precompute random numbers
-func randRange(size, seed int) (slice []Int) {
-	rng := rand.New(rand.NewSource(int64(seed)))
-	slice = make([]Int, size)
-	for i := 0; i < size; i++ {
-		slice[i] = Int(rng.Int())
+func TestMatchesSlice(t *testing.T) {
+	tree := New()
+	for _, i := range []int{3, 1, 2} {
+		tree.Insert(Int(i))
 	}
 
-	return
+	if !tree.MatchesSlice([]Item{Int(1), Int(2), Int(3)}) {
+		t.Fatal("MatchesSlice rejected the tree's own order")
+	}
+
+	if tree.MatchesSlice([]Item{Int(1), Int(3), Int(2)}) {
+		t.Fatal("MatchesSlice accepted a reordered slice")
+	}
+
+	if tree.MatchesSlice([]Item{Int(1), Int(2)}) || tree.MatchesSlice([]Item{Int(1), Int(2), Int(3), Int(4)}) {
+		t.Fatal("MatchesSlice accepted a slice of the wrong length")
+	}
+
+	if tree.MatchesSlice([]Item{Int(1), nil, Int(3)}) {
+		t.Fatal("MatchesSlice accepted a nil element")
+	}
+
+	if !New().MatchesSlice(nil) {
+		t.Fatal("An empty tree should match an empty slice")
+	}
 }
 
-// Build a large tree of random integers.
-func BenchmarkRBInsert(b *testing.B) {
-	ints := randRange(1<<16, 43)
-	b.ResetTimer()
+func TestChildrenOf(t *testing.T) {
+	// Inserting 1 through 4 in order produces the following tree:
+	//
+	//      2
+	//     / \
+	//    1   3
+	//         \
+	//          4
+	tree := New()
+	for i := 1; i <= 4; i++ {
+		tree.Insert(Int(i))
+	}
 
-	for i := 0; i < b.N; i++ {
-		tree := New()
-		for _, n := range ints {
-			tree.Insert(n)
+	check := func(item int, left, right Item, leftOK, rightOK bool) {
+		l, r, lok, rok := tree.ChildrenOf(Int(item))
+		if l != left || r != right || lok != leftOK || rok != rightOK {
+			t.Errorf("ChildrenOf(%d) = (%v, %v, %v, %v), expected (%v, %v, %v, %v)",
+				item, l, r, lok, rok, left, right, leftOK, rightOK)
 		}
 	}
+
+	check(2, Int(1), Int(3), true, true)
+	check(3, nil, Int(4), false, true)
+	check(1, nil, nil, false, false)
+	check(4, nil, nil, false, false)
+	check(5, nil, nil, false, false)
+
+	if _, _, lok, rok := New().ChildrenOf(Int(1)); lok || rok {
+		t.Error("ChildrenOf reported children in an empty tree")
+	}
 }
 
-// Build a large tree of random integers, then delete every element one
-// by one.
-func BenchmarkRBDelete(b *testing.B) {
-	ints := randRange(1<<16, 43)
-	b.ResetTimer()
+// An Item whose ordering can be reversed after it has been inserted into a
+// tree, simulating a broken Less method.
+type flakyInt int
 
-	for i := 0; i < b.N; i++ {
-		// Build the tree
-		b.StopTimer()
+var flakyReversed = false
+
+func (i flakyInt) Less(than Item) bool {
+	if flakyReversed {
+		return i > than.(flakyInt)
+	}
+
+	return i < than.(flakyInt)
+}
+
+func TestSelfCheck(t *testing.T) {
+	if err := New().SelfCheck(10); err != nil {
+		t.Fatal("Empty tree failed SelfCheck:", err)
+	}
+
+	tree := New()
+	for i := 0; i < 100; i++ {
+		tree.Insert(flakyInt(i))
+	}
+
+	if err := tree.SelfCheck(100); err != nil {
+		t.Fatal("Valid tree failed SelfCheck:", err)
+	}
+
+	flakyReversed = true
+	defer func() { flakyReversed = false }()
+
+	if err := tree.SelfCheck(100); err == nil {
+		t.Fatal("SelfCheck did not detect a misordered tree")
+	}
+}
+
+func TestIterateFrom(t *testing.T) {
+	tree := New()
+	for _, i := range []int{10, 20, 30, 40} {
+		tree.Insert(Int(i))
+	}
+
+	collect := func(start int, wrap bool) []int {
+		var items []int
+		for item := range tree.IterateFrom(Int(start), wrap) {
+			items = append(items, int(item.(Int)))
+		}
+
+		return items
+	}
+
+	check := func(start int, wrap bool, expected []int) {
+		if got := collect(start, wrap); fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("IterateFrom(%d, %v) = %v, expected %v", start, wrap, got, expected)
+		}
+	}
+
+	check(20, true, []int{20, 30, 40, 10})
+	check(25, true, []int{30, 40, 10, 20})
+	check(10, true, []int{10, 20, 30, 40})
+	check(50, true, []int{10, 20, 30, 40})
+	check(25, false, []int{30, 40})
+	check(50, false, nil)
+
+	// Stopping early must not visit any more items.
+	for item := range tree.IterateFrom(Int(30), true) {
+		if item != Int(30) {
+			t.Errorf("Expected to stop after the first item, got %v", item)
+		}
+
+		break
+	}
+
+	for range New().IterateFrom(Int(0), true) {
+		t.Error("IterateFrom yielded an item from an empty tree")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	// Inserting 1 through 4 in order produces the following tree:
+	//
+	//      2
+	//     / \
+	//    1   3
+	//         \
+	//          4
+	tree := New()
+	for i := 1; i <= 4; i++ {
+		tree.Insert(Int(i))
+	}
+
+	check := func(item int, found bool, comparisons int) {
+		f, c := tree.Probe(Int(item))
+		if f != found || c != comparisons {
+			t.Errorf("Probe(%d) = (%v, %d), expected (%v, %d)", item, f, c, found, comparisons)
+		}
+	}
+
+	// Finding an item takes two comparisons at its own node, plus one for
+	// every left turn and two for every right turn on the way down.
+	check(2, true, 2)
+	check(1, true, 3)
+	check(3, true, 4)
+	check(4, true, 6)
+	check(0, false, 2)
+	check(5, false, 6)
+
+	if found, c := New().Probe(Int(1)); found || c != 0 {
+		t.Errorf("Probe on an empty tree = (%v, %d)", found, c)
+	}
+}
+
+func TestConversion(t *testing.T) {
+	tree := New()
+	for i := 1; i <= 5; i++ {
+		tree.Insert(Int(i))
+	}
+
+	it, _ := tree.Find(Int(2))
+	multi := tree.AsMultiValued()
+	multi.Insert(Int(2))
+	assertRangeEq(t, it, multi.End(), []int{2, 2, 3, 4, 5})
+	checkTree(t, multi.inner, []int{1, 2, 2, 3, 4, 5})
+
+	if _, ok := multi.AsUnique(); ok {
+		t.Fatal("Converted a tree with duplicates to unique")
+	}
+
+	multi.Delete(Int(2))
+	it = multi.First()
+	unique, ok := multi.AsUnique()
+	if !ok {
+		t.Fatal("Failed to convert a tree without duplicates to unique")
+	}
+	if unique.Insert(Int(3)) {
+		t.Fatal("Inserted a duplicate into a tree converted back to unique")
+	}
+
+	assertRangeEq(t, it, unique.End(), []int{1, 2, 3, 4, 5})
+}
+
+// A sample of a function at point x
+type sample struct {
+	x, y float64
+}
+
+func (s sample) Less(than Item) bool {
+	return s.x < than.(sample).x
+}
+
+func TestInterpolate(t *testing.T) {
+	tree := New()
+	tree.Insert(sample{0, 0})
+	tree.Insert(sample{10, 100})
+	tree.Insert(sample{20, 300})
+
+	lerp := func(a, b Item, f float64) Item {
+		sa, sb := a.(sample), b.(sample)
+		return sample{sa.x + f*(sb.x-sa.x), sa.y + f*(sb.y-sa.y)}
+	}
+
+	check := func(lo, hi, frac float64, expected Item) {
+		got := tree.Interpolate(sample{x: lo}, sample{x: hi}, frac, lerp)
+		if got != expected {
+			t.Errorf("Interpolate(%v, %v, %v) = %v, expected %v", lo, hi, frac, got, expected)
+		}
+	}
+
+	check(2, 8, 0.5, sample{5, 50})
+	check(12, 18, 0.25, sample{12.5, 150})
+	check(10, 10, 0.5, sample{10, 100})
+	check(5, 15, 0.5, sample{10, 150})
+	check(-1, 5, 0.5, nil)
+	check(15, 25, 0.5, nil)
+}
+
+func TestFromSliceStats(t *testing.T) {
+	items := []Item{Int(3), Int(1), Int(3), Int(2), Int(1), Int(3)}
+	tree, dropped := FromSliceStats(items)
+	if dropped != 3 {
+		t.Errorf("Expected 3 duplicates to be dropped, got %d", dropped)
+	}
+
+	checkTree(t, tree.inner, []int{1, 2, 3})
+
+	if tree, dropped := FromSliceStats(nil); !tree.Empty() || dropped != 0 {
+		t.Error("Building from an empty slice should produce an empty tree")
+	}
+
+	checkTree(t, FromSlice(items).inner, []int{1, 2, 3})
+
+	if tree, dropped := FromSliceStats([]Item{nil, Int(1), nil}); dropped != 0 {
+		t.Errorf("Counted %d nil entries as duplicates", dropped)
+	} else {
+		checkTree(t, tree.inner, []int{1})
+	}
+}
+
+func TestSplitAtRank(t *testing.T) {
+	members := make([]int, 100)
+	for i := range members {
+		members[i] = i
+	}
+
+	for _, k := range []int{-1, 0, 1, 50, 99, 100, 101} {
 		tree := New()
-		for _, n := range ints {
-			tree.Insert(n)
+		for _, i := range rand.Perm(len(members)) {
+			tree.Insert(Int(i))
 		}
-		b.StartTimer()
 
-		// Delete every item in the tree
-		for _, n := range ints {
-			tree.Delete(n)
+		split := k
+		if split < 0 {
+			split = 0
+		} else if split > len(members) {
+			split = len(members)
+		}
+
+		left, right := tree.SplitAtRank(k)
+		checkTree(t, left.inner, members[:split])
+		checkTree(t, right.inner, members[split:])
+		if !tree.Empty() {
+			t.Fatal("SplitAtRank did not consume the original tree")
+		}
+	}
+
+	// Both halves keep the settings of the tree, including its order.
+	for _, k := range []int{0, 2, 5} {
+		tree := NewReversed()
+		for _, i := range []int{3, 1, 4, 5, 2} {
+			tree.Insert(Int(i))
+		}
+
+		// The first k items of a reversed tree are the largest.
+		left, right := tree.SplitAtRank(k)
+		if !left.reversed || !right.reversed {
+			t.Fatalf("SplitAtRank(%d) of a reversed tree gave unreversed halves", k)
+		}
+		checkTree(t, left.inner, []int{1, 2, 3, 4, 5}[5-k:])
+		checkTree(t, right.inner, []int{1, 2, 3, 4, 5}[:5-k])
+		if k > 0 && left.Min() != Int(5) || k < 5 && right.Min() != Int(5-k) {
+			t.Errorf("SplitAtRank(%d) of a reversed tree gave Mins %v and %v", k, left.Min(), right.Min())
+		}
+	}
+
+	decode := func(data json.RawMessage) (Item, error) {
+		var i int
+		err := json.Unmarshal(data, &i)
+		return Int(i), err
+	}
+
+	tree := NewJSON(decode)
+	tree.Insert(Int(1))
+	tree.Insert(Int(2))
+	left, right := tree.SplitAtRank(1)
+	if left.UnmarshalJSON([]byte("[3]")) != nil || right.UnmarshalJSON([]byte("[4]")) != nil {
+		t.Error("The halves of a NewJSON tree can't be decoded into")
+	}
+}
+
+func TestFlip(t *testing.T) {
+	tree := New()
+	for _, i := range []int{3, 1, 4, 5, 2} {
+		tree.Insert(Int(i))
+	}
+
+	collect := func(begin, end Iterator) []int {
+		var items []int
+		for it := begin; it != end; it.Next() {
+			items = append(items, int(it.Item().(Int)))
+		}
+
+		return items
+	}
+
+	check := func(got, expected []int) {
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	}
+
+	tree.Flip()
+	check(collect(tree.First(), tree.End()), []int{5, 4, 3, 2, 1})
+	check(collect(tree.LowerBound(Int(4)), tree.UpperBound(Int(2))), []int{4, 3, 2})
+	check(collect(tree.UpperBound(Int(4)), tree.End()), []int{3, 2, 1})
+	check(collect(tree.LowerBound(Int(0)), tree.End()), nil)
+	check(collect(tree.UpperBound(Int(6)), tree.End()), []int{5, 4, 3, 2, 1})
+
+	if tree.Min() != Int(5) || tree.Max() != Int(1) || tree.Last().Item() != Int(1) {
+		t.Error("Flip did not swap the minimum and maximum")
+	}
+
+	it, _ := tree.Find(Int(3))
+	it.Next()
+	if it.Item() != Int(2) {
+		t.Errorf("Expected to step from 3 to 2, got %v", it.Item())
+	}
+
+	it.Prev()
+	it.Prev()
+	if it.Item() != Int(4) {
+		t.Errorf("Expected to step back from 2 to 4, got %v", it.Item())
+	}
+
+	var visited []int
+	tree.ForEach(func(item Item) bool {
+		visited = append(visited, int(item.(Int)))
+		return true
+	})
+	check(visited, []int{5, 4, 3, 2, 1})
+
+	visited = nil
+	for item := range tree.IterateFrom(Int(3), true) {
+		visited = append(visited, int(item.(Int)))
+	}
+	check(visited, []int{3, 2, 1, 5, 4})
+
+	if fmt.Sprint(tree.ToSlice()) != "[5 4 3 2 1]" || !tree.MatchesSlice(tree.ToSlice()) {
+		t.Errorf("ToSlice of a flipped tree is %v", tree.ToSlice())
+	}
+
+	for k := 0; k < 5; k++ {
+		item, ok := tree.Select(k)
+		if !ok || item != Int(5-k) || tree.Rank(item) != k {
+			t.Errorf("Select(%d) of a flipped tree is %v, whose rank is %d", k, item, tree.Rank(item))
+		}
+	}
+	if _, ok := tree.Select(5); ok {
+		t.Error("Selected past the end of a flipped tree")
+	}
+	if r := tree.Rank(Int(0)); r != 5 {
+		t.Errorf("Rank(0) of a flipped tree is %d, expected 5", r)
+	}
+
+	tree.Flip()
+	check(collect(tree.First(), tree.End()), []int{1, 2, 3, 4, 5})
+	checkTree(t, tree.inner, []int{1, 2, 3, 4, 5})
+}
+
+func TestOptimizeForReads(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	tree := NewAggregated(
+		func(item Item) int { return int(item.(Int)) },
+		func(a, b int) int { return a + b },
+		0,
+	)
+	present := make(map[int]bool)
+	modify := func(n int) {
+		for i := 0; i < n; i++ {
+			x := rng.Intn(2000)
+			tree.Insert(Int(x))
+			present[x] = true
+			if i%3 == 0 {
+				x = rng.Intn(2000)
+				tree.Delete(Int(x))
+				delete(present, x)
+			}
+		}
+	}
+	members := func() []int {
+		var ints []int
+		for x := range present {
+			ints = append(ints, x)
+		}
+		return ints
+	}
+
+	modify(3000)
+	tree.Flip()
+	first := tree.First().Item()
+	sum := tree.RangeAggregate(tree.First(), tree.End()).(int)
+	tree.OptimizeForReads()
+
+	checkTree(t, tree.inner, members())
+	if tree.First().Item() != first {
+		t.Errorf("OptimizeForReads did not keep the order the tree is viewed in")
+	}
+	if got := tree.RangeAggregate(tree.First(), tree.End()).(int); got != sum {
+		t.Errorf("Sum is %d after OptimizeForReads, expected %d", got, sum)
+	}
+
+	// The tree remains usable after the nodes have moved.
+	modify(500)
+	checkTree(t, tree.inner, members())
+
+	var empty Tree
+	empty.OptimizeForReads()
+	if !empty.Empty() {
+		t.Errorf("Optimizing an empty tree added items")
+	}
+}
+
+func TestVebLayout(t *testing.T) {
+	items := make([]Item, 15)
+	for i := range items {
+		items[i] = Int(i)
+	}
+
+	built := buildSorted(items)
+	var order []Item
+	for _, n := range vebLayout(built.root, 4, nil) {
+		order = append(order, n.item)
+	}
+
+	// The top two levels, then each of the four subtrees of three nodes below.
+	expected := []Item{Int(7), Int(3), Int(11), Int(1), Int(0), Int(2), Int(5), Int(4), Int(6), Int(9), Int(8), Int(10), Int(13), Int(12), Int(14)}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("Layout is %v, expected %v", order, expected)
+	}
+}
+
+func TestInsertOrReplaceIter(t *testing.T) {
+	tree := New()
+	tree.Insert(keyValue{1, "one"})
+	tree.Insert(keyValue{3, "three"})
+
+	old, it := tree.InsertOrReplaceIter(keyValue{2, "two"})
+	if old != nil {
+		t.Errorf("Expected no previous item, got %v", old)
+	}
+
+	if it.Item() != (keyValue{2, "two"}) {
+		t.Errorf("Iterator points to %v instead of the new item", it.Item())
+	}
+
+	it.Next()
+	if it.Item() != (keyValue{3, "three"}) {
+		t.Errorf("Iterator did not advance to the next item, got %v", it.Item())
+	}
+
+	old, it = tree.InsertOrReplaceIter(keyValue{1, "uno"})
+	if old != (keyValue{1, "one"}) {
+		t.Errorf("Expected to replace {1 one}, got %v", old)
+	}
+
+	if it.Item() != (keyValue{1, "uno"}) || tree.Size() != 3 {
+		t.Errorf("Iterator points to %v instead of the replacement", it.Item())
+	}
+}
+
+func TestKeepNewest(t *testing.T) {
+	tree := New()
+	for i := 0; i < 20; i++ {
+		tree.Insert(Int(1000 + i))
+	}
+
+	if removed := tree.KeepNewest(25); removed != 0 || tree.Size() != 20 {
+		t.Fatalf("KeepNewest with n > Size removed %d items", removed)
+	}
+
+	if removed := tree.KeepNewest(5); removed != 15 {
+		t.Fatalf("Expected to remove 15 items, removed %d", removed)
+	}
+
+	checkTree(t, tree.inner, []int{1015, 1016, 1017, 1018, 1019})
+
+	if removed := tree.KeepNewest(0); removed != 5 || !tree.Empty() {
+		t.Fatalf("KeepNewest(0) should empty the tree")
+	}
+
+	reversed := NewReversed()
+	for _, i := range []int{3, 1, 4, 5, 2} {
+		reversed.Insert(Int(i))
+	}
+
+	reversed.KeepNewest(2)
+	if !reversed.reversed || reversed.Min() != Int(5) || reversed.Max() != Int(4) {
+		t.Errorf("KeepNewest on a reversed tree gave Min %v and Max %v", reversed.Min(), reversed.Max())
+	}
+}
+
+func treeOf(items ...int) Tree {
+	tree := New()
+	for _, i := range items {
+		tree.Insert(Int(i))
+	}
+
+	return tree
+}
+
+func TestDisjoint(t *testing.T) {
+	tests := []struct {
+		a, b     Tree
+		disjoint bool
+	}{
+		{treeOf(1, 3, 5), treeOf(2, 4, 6), true},
+		{treeOf(1, 2, 3), treeOf(4, 5, 6), true},
+		{treeOf(1, 2, 3), treeOf(3, 4, 5), false},
+		{treeOf(1, 5, 9), treeOf(0, 9), false},
+		{treeOf(), treeOf(1), true},
+		{treeOf(), treeOf(), true},
+	}
+
+	for i, test := range tests {
+		if Disjoint(test.a, test.b) != test.disjoint || Disjoint(test.b, test.a) != test.disjoint {
+			t.Errorf("Test %d: expected Disjoint to be %v", i, test.disjoint)
+		}
+	}
+}
+
+func TestIsSubsetOf(t *testing.T) {
+	tests := []struct {
+		a, b   Tree
+		subset bool
+	}{
+		{treeOf(2, 4), treeOf(1, 2, 3, 4), true},
+		{treeOf(1, 2, 3), treeOf(1, 2, 3), true},
+		{treeOf(), treeOf(1), true},
+		{treeOf(), treeOf(), true},
+		{treeOf(1, 5), treeOf(1, 2, 3, 4), false},
+		{treeOf(0, 2), treeOf(1, 2, 3), false},
+		{treeOf(1, 2, 3), treeOf(1, 2), false},
+	}
+
+	for i, test := range tests {
+		if test.a.IsSubsetOf(test.b) != test.subset {
+			t.Errorf("Test %d: expected IsSubsetOf to be %v", i, test.subset)
+		}
+
+		if test.b.IsSupersetOf(test.a) != test.subset {
+			t.Errorf("Test %d: expected IsSupersetOf to be %v", i, test.subset)
+		}
+	}
+}
+
+func TestLongestConsecutiveRun(t *testing.T) {
+	next := func(i Item) Item { return i.(Int) + 1 }
+	equal := func(a, b Item) bool { return a == b }
+
+	tests := []struct {
+		tree   Tree
+		start  Item
+		length int
+	}{
+		{treeOf(1, 2, 3, 7, 8, 9, 10, 20), Int(7), 4},
+		{treeOf(1, 2, 3, 7, 8, 9), Int(1), 3},
+		{treeOf(5, 10, 15), Int(5), 1},
+		{treeOf(4, 5, 6, 7), Int(4), 4},
+		{treeOf(), nil, 0},
+	}
+
+	for i, test := range tests {
+		start, length := test.tree.LongestConsecutiveRun(next, equal)
+		if start != test.start || length != test.length {
+			t.Errorf("Test %d: got (%v, %d), expected (%v, %d)", i, start, length, test.start, test.length)
+		}
+	}
+}
+
+func TestFromMapKeys(t *testing.T) {
+	m := map[string]struct{}{"pear": {}, "apple": {}, "fig": {}, "banana": {}}
+	tree := FromMapKeys(m, func(k string) Item { return String(k) })
+
+	var keys []string
+	for it := tree.First(); it != tree.End(); it.Next() {
+		keys = append(keys, string(it.Item().(String)))
+	}
+
+	if fmt.Sprint(keys) != "[apple banana fig pear]" {
+		t.Errorf("Map keys were not sorted, got %v", keys)
+	}
+}
+
+func TestMergeChannel(t *testing.T) {
+	merge := func(tree Tree, stream ...int) []int {
+		in, out := make(chan Item), make(chan Item)
+		go func() {
+			for _, i := range stream {
+				in <- Int(i)
+			}
+
+			close(in)
+		}()
+
+		go tree.MergeChannel(in, out)
+
+		var merged []int
+		for item := range out {
+			merged = append(merged, int(item.(Int)))
+		}
+
+		return merged
+	}
+
+	check := func(got []int, expected string) {
+		if fmt.Sprint(got) != expected {
+			t.Errorf("Expected %s, got %v", expected, got)
+		}
+	}
+
+	check(merge(treeOf(1, 4, 6), 2, 3, 4, 8, 9), "[1 2 3 4 4 6 8 9]")
+	check(merge(treeOf(5, 6, 7), 1, 2), "[1 2 5 6 7]")
+	check(merge(treeOf(1, 2), 5, 6, 7), "[1 2 5 6 7]")
+	check(merge(treeOf(1, 2)), "[1 2]")
+	check(merge(treeOf(), 1, 2), "[1 2]")
+}
+
+func TestOnGrid(t *testing.T) {
+	tree := treeOf(-5, 0, 3, 5, 7, 10, 11, 20, 25, 26)
+
+	check := func(origin, step Int, expected string) {
+		if got := tree.OnGrid(origin, step); fmt.Sprint(got) != expected {
+			t.Errorf("OnGrid(%d, %d) = %v, expected %s", origin, step, got, expected)
+		}
+	}
+
+	check(0, 5, "[0 5 10 20 25]")
+	check(1, 5, "[11 26]")
+	check(3, 4, "[3 7 11]")
+	check(30, 5, "[]")
+	check(0, 0, "[]")
+
+	// The next grid point after the largest items would overflow.
+	tree = New()
+	for _, i := range []Int{math.MaxInt - 7, math.MaxInt - 1, math.MaxInt} {
+		tree.Insert(i)
+	}
+	check(math.MaxInt-7, 10, fmt.Sprint([]Int{math.MaxInt - 7}))
+	check(math.MaxInt-1, 1, fmt.Sprint([]Int{math.MaxInt - 1, math.MaxInt}))
+	check(0, 1, fmt.Sprint([]Int{math.MaxInt - 7, math.MaxInt - 1, math.MaxInt}))
+}
+
+func TestIndexRange(t *testing.T) {
+	members := []int{2, 4, 6, 8, 10}
+	tree := treeOf(members...)
+
+	// Compute the expected range by scanning the sorted slice.
+	expected := func(lo, hi int) (begin, end int) {
+		for begin < len(members) && members[begin] < lo {
+			begin += 1
+		}
+
+		for end = begin; end < len(members) && members[end] < hi; end++ {
+		}
+
+		return
+	}
+
+	for lo := 0; lo <= 12; lo++ {
+		for hi := 0; hi <= 12; hi++ {
+			b, e := tree.IndexRange(Int(lo), Int(hi))
+			eb, ee := expected(lo, hi)
+			if b != eb || e != ee {
+				t.Errorf("IndexRange(%d, %d) = [%d, %d), expected [%d, %d)", lo, hi, b, e, eb, ee)
+			}
+		}
+	}
+
+	// A flipped tree counts indices in descending order, so negating the
+	// members and bounds gives the same ranges.
+	tree.Flip()
+	for i, m := range members {
+		members[i] = -m
+	}
+	sort.Ints(members)
+	for lo := 0; lo <= 12; lo++ {
+		for hi := 0; hi <= 12; hi++ {
+			b, e := tree.IndexRange(Int(lo), Int(hi))
+			eb, ee := expected(-lo, -hi)
+			if b != eb || e != ee {
+				t.Errorf("Flipped IndexRange(%d, %d) = [%d, %d), expected [%d, %d)", lo, hi, b, e, eb, ee)
+			}
+		}
+	}
+}
+
+func TestDeleteOK(t *testing.T) {
+	tree := treeOf(1, 2, 3)
+
+	if item, ok := tree.DeleteOK(Int(2)); !ok || item != Int(2) {
+		t.Errorf("DeleteOK(2) = (%v, %v), expected (2, true)", item, ok)
+	}
+
+	if item, ok := tree.DeleteOK(Int(2)); ok || item != nil {
+		t.Errorf("DeleteOK of a missing item = (%v, %v), expected (nil, false)", item, ok)
+	}
+
+	checkTree(t, tree.inner, []int{1, 3})
+
+	empty := New()
+	if _, ok := empty.DeleteOK(Int(1)); ok {
+		t.Error("DeleteOK found an item in an empty tree")
+	}
+}
+
+// An Item whose Less method claims every item is less than every other.
+type brokenInt int
+
+func (i brokenInt) Less(than Item) bool {
+	return true
+}
+
+func TestNewChecked(t *testing.T) {
+	tree := NewChecked()
+	for _, i := range rand.Perm(100) {
+		tree.Insert(Int(i))
+	}
+
+	for i := 0; i < 100; i += 2 {
+		tree.Delete(Int(i))
+	}
+
+	defer func() {
+		msg, ok := recover().(string)
+		if !ok || !strings.Contains(msg, "Insert") {
+			t.Fatalf("Expected a panic naming Insert, got %v", msg)
+		}
+	}()
+
+	broken := NewChecked()
+	broken.Insert(brokenInt(1))
+	broken.Insert(brokenInt(2))
+	t.Fatal("Inserting items with a broken Less did not panic")
+}
+
+func TestGroupBy(t *testing.T) {
+	tree := treeOf(5, 2, 8, 1, 4, 7, 3)
+	groups := tree.GroupBy(func(item Item) interface{} {
+		return item.(Int)%2 == 0
+	})
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	if even := fmt.Sprint(groups[true]); even != "[2 4 8]" {
+		t.Errorf("Expected even group [2 4 8], got %s", even)
+	}
+
+	if odd := fmt.Sprint(groups[false]); odd != "[1 3 5 7]" {
+		t.Errorf("Expected odd group [1 3 5 7], got %s", odd)
+	}
+
+	if len(New().GroupBy(func(Item) interface{} { return 0 })) != 0 {
+		t.Error("Grouping an empty tree should produce no groups")
+	}
+}
+
+func TestInsertDistinct(t *testing.T) {
+	byValue := func(a, b Item) bool {
+		return a.(keyValue).value < b.(keyValue).value
+	}
+
+	tree := New()
+	for _, item := range []keyValue{{2, "b"}, {1, "z"}, {2, "a"}, {3, "x"}, {2, "c"}} {
+		if !tree.InsertDistinct(item, byValue) {
+			t.Fatalf("InsertDistinct rejected %v", item)
+		}
+	}
+
+	if tree.InsertDistinct(keyValue{2, "a"}, byValue) {
+		t.Fatal("InsertDistinct accepted an item equal under both orderings")
+	}
+
+	var got []string
+	for it := tree.First(); it != tree.End(); it.Next() {
+		item := it.Item().(keyValue)
+		got = append(got, fmt.Sprintf("%d%s", item.key, item.value))
+	}
+
+	if fmt.Sprint(got) != "[1z 2a 2b 2c 3x]" {
+		t.Errorf("Items were iterated in the wrong order: %v", got)
+	}
+
+	if err := tree.inner.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tree is ordered, but no longer unique under Less.
+	if tree.DebugValidate() == nil {
+		t.Error("DebugValidate accepted equivalent items")
+	}
+}
+
+func TestSortedView(t *testing.T) {
+	view := treeOf(10, 20, 30, 40, 50).View()
+	if view.Len() != 5 {
+		t.Fatalf("Expected a view of length 5, got %d", view.Len())
+	}
+
+	for i := 0; i < view.Len(); i++ {
+		if view.At(i) != Int(10*(i+1)) {
+			t.Errorf("At(%d) = %v, expected %d", i, view.At(i), 10*(i+1))
+		}
+	}
+
+	i := sort.Search(view.Len(), func(i int) bool { return !view.At(i).Less(Int(25)) })
+	if i != 2 {
+		t.Errorf("sort.Search for 25 found index %d, expected 2", i)
+	}
+
+	if i, ok := view.Find(Int(40)); i != 3 || !ok {
+		t.Errorf("Find(40) = (%d, %v), expected (3, true)", i, ok)
+	}
+
+	if i, ok := view.Find(Int(45)); i != 4 || ok {
+		t.Errorf("Find(45) = (%d, %v), expected (4, false)", i, ok)
+	}
+
+	if i, ok := view.Find(Int(60)); i != 5 || ok {
+		t.Errorf("Find(60) = (%d, %v), expected (5, false)", i, ok)
+	}
+}
+
+func TestMarshalDelta(t *testing.T) {
+	toInt := func(item Item) int64 { return int64(item.(Int)) }
+	fromInt := func(i int64) Item { return Int(i) }
+
+	// Clusters of consecutive integers separated by large gaps
+	var members []int
+	tree := New()
+	for base := -1000000; base < 1000000; base += 100000 {
+		for i := 0; i < 50; i++ {
+			members = append(members, base+i)
+			tree.Insert(Int(base + i))
+		}
+	}
+
+	data := tree.MarshalDelta(toInt)
+	if len(data) >= 2*len(members) {
+		t.Errorf("Encoding %d clustered keys took %d bytes", len(members), len(data))
+	}
+
+	decoded, err := UnmarshalDelta(data, fromInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTree(t, decoded.inner, members)
+
+	if empty, err := UnmarshalDelta(New().MarshalDelta(toInt), fromInt); err != nil || !empty.Empty() {
+		t.Fatal("Failed to round-trip an empty tree")
+	}
+
+	if _, err := UnmarshalDelta([]byte{0x80}, fromInt); err == nil {
+		t.Fatal("Decoding a truncated varint should fail")
+	}
+
+	// Keys 5, 3, 3, 8 are out of order and repeated, so they can't be built
+	// directly.
+	var unsorted []byte
+	for _, delta := range []int64{5, -2, 0, 5} {
+		unsorted = binary.AppendVarint(unsorted, delta)
+	}
+
+	decoded, err = UnmarshalDelta(unsorted, fromInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTree(t, decoded.inner, []int{3, 5, 8})
+
+	// A key which fromInt can't convert is an error, not a panic.
+	odd := func(key int64) Item {
+		if key%2 == 0 {
+			return nil
+		}
+		return Int(key)
+	}
+	if _, err := UnmarshalDelta(unsorted, odd); !errors.Is(err, ErrNilItem) {
+		t.Errorf("Decoding a nil item returned %v", err)
+	}
+}
+
+func TestPercentileRange(t *testing.T) {
+	members := make([]int, 200)
+	for i := range members {
+		members[i] = i * 3
+	}
+
+	tree := treeOf(members...)
+	tests := []struct {
+		lo, hi   float64
+		from, to int
+	}{
+		{0.25, 0.75, 50, 150},
+		{0, 1, 0, 200},
+		{-1, 2, 0, 200},
+		{0.5, 0.5, 100, 100},
+		{0.9, 0.1, 180, 180},
+		{0.999, 1, 199, 200},
+	}
+
+	for _, test := range tests {
+		begin, end := tree.PercentileRange(test.lo, test.hi)
+		assertRangeEq(t, begin, end, members[test.from:test.to])
+	}
+
+	// Ranks in a flipped tree count from the maximum.
+	tree.Flip()
+	sort.Sort(sort.Reverse(sort.IntSlice(members)))
+	for _, test := range tests {
+		begin, end := tree.PercentileRange(test.lo, test.hi)
+		assertRangeEq(t, begin, end, members[test.from:test.to])
+		if n := Distance(begin, end); n != test.to-test.from {
+			t.Errorf("Flipped PercentileRange(%v, %v) has %d items", test.lo, test.hi, n)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tree := treeOf(1, 2, 3)
+
+	err := tree.Apply([]Op{
+		{OpInsert, Int(4)},
+		{OpDelete, Int(1)},
+		{OpInsert, Int(0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTree(t, tree.inner, []int{0, 2, 3, 4})
+
+	err = tree.Apply([]Op{
+		{OpInsert, Int(5)},
+		{OpDelete, Int(2)},
+		{OpInsert, Int(3)},
+		{OpDelete, Int(4)},
+	})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("Expected ErrDuplicate, got %v", err)
+	}
+
+	checkTree(t, tree.inner, []int{0, 2, 3, 4})
+
+	err = tree.Apply([]Op{{OpDelete, Int(0)}, {OpDelete, Int(9)}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	checkTree(t, tree.inner, []int{0, 2, 3, 4})
+
+	for _, kind := range []OpKind{OpInsert, OpDelete} {
+		err = tree.Apply([]Op{{OpInsert, Int(5)}, {kind, nil}})
+		if !errors.Is(err, ErrNilItem) {
+			t.Fatalf("Expected ErrNilItem, got %v", err)
+		}
+	}
+
+	checkTree(t, tree.inner, []int{0, 2, 3, 4})
+}
+
+func TestLongestCommonRun(t *testing.T) {
+	tests := []struct {
+		a, b     Tree
+		expected string
+	}{
+		{treeOf(1, 2, 5, 6, 7, 8, 12), treeOf(0, 5, 6, 7, 8, 10, 12), "[5 6 7 8]"},
+		{treeOf(1, 2, 3, 4), treeOf(1, 2, 3, 4), "[1 2 3 4]"},
+		{treeOf(1, 2, 4, 5), treeOf(1, 2, 3, 4, 5), "[1 2]"},
+		{treeOf(1, 3, 5), treeOf(2, 4, 6), "[]"},
+		{treeOf(), treeOf(1), "[]"},
+	}
+
+	for i, test := range tests {
+		if got := fmt.Sprint(LongestCommonRun(test.a, test.b)); got != test.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, test.expected, got)
+		}
+	}
+}
+
+func TestForEachGrouped(t *testing.T) {
+	tree := NewMultiValued()
+	for _, i := range []int{3, 2, 1, 3, 2, 3} {
+		tree.Insert(Int(i))
+	}
+
+	var got []string
+	tree.ForEachGrouped(func(item Item, first, last bool) bool {
+		got = append(got, fmt.Sprintf("%v:%v:%v", item, first, last))
+		return true
+	})
+
+	expected := "[1:true:true 2:true:false 2:false:true 3:true:false 3:false:false 3:false:true]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("Expected %s, got %v", expected, got)
+	}
+
+	calls := 0
+	tree.ForEachGrouped(func(Item, bool, bool) bool {
+		calls += 1
+		return calls < 2
+	})
+
+	if calls != 2 {
+		t.Errorf("Expected iteration to stop after 2 calls, got %d", calls)
+	}
+}
+
+func TestKeyAtCumulativeWeight(t *testing.T) {
+	rand.Seed(48)
+
+	weight := func(item Item) float64 { return float64(item.(Int)%7) + 0.5 }
+
+	weighted := NewWeighted(weight)
+	if item, ok := weighted.KeyAtCumulativeWeight(0); ok || item != nil {
+		t.Fatalf("KeyAtCumulativeWeight on an empty tree = (%v, %v)", item, ok)
+	}
+
+	members := rand.Perm(100)
+	for _, m := range members {
+		weighted.Insert(Int(m))
+	}
+	for _, m := range members[:20] {
+		weighted.Delete(Int(m))
+	}
+	members = members[20:]
+	sort.Ints(members)
+
+	// Finds the first item after which the weight of the items before it
+	// exceeds w by scanning members.
+	bruteForce := func(w float64) Item {
+		sum := 0.0
+		for _, m := range members {
+			if sum > w {
+				return Int(m)
+			}
+			sum += weight(Int(m))
+		}
+
+		return nil
+	}
+
+	total := 0.0
+	for _, m := range members {
+		total += weight(Int(m))
+	}
+
+	check := func(w float64) {
+		expected := bruteForce(w)
+		item, ok := weighted.KeyAtCumulativeWeight(w)
+		if item != expected || ok != (expected != nil) {
+			t.Fatalf("KeyAtCumulativeWeight(%v) = (%v, %v), expected %v", w, item, ok, expected)
+		}
+	}
+
+	for i := 0; i < 500; i++ {
+		check(rand.Float64()*(total+10) - 5)
+	}
+
+	// The first item has no items before it, so it is only found for a
+	// negative w.
+	if item, _ := weighted.KeyAtCumulativeWeight(0); item != Int(members[1]) {
+		t.Errorf("KeyAtCumulativeWeight(0) = %v, expected %v", item, members[1])
+	}
+
+	// The weights of a flipped tree accumulate from the maximum.
+	weighted.Flip()
+	sort.Sort(sort.Reverse(sort.IntSlice(members)))
+	for i := 0; i < 500; i++ {
+		check(rand.Float64()*(total+10) - 5)
+	}
+
+	// Aggregates other than weights can't be searched.
+	defer func() {
+		if recover() == nil {
+			t.Errorf("KeyAtCumulativeWeight of an unweighted tree did not panic")
+		}
+	}()
+	sums := NewAggregated(weight, func(a, b float64) float64 { return a + b }, 0)
+	sums.Insert(Int(1))
+	sums.KeyAtCumulativeWeight(0)
+}
+
+// A closed interval of integers, ordered by its start
+type interval struct {
+	lo, hi int
+}
+
+func (i interval) Less(than Item) bool {
+	return i.lo < than.(interval).lo
+}
+
+func TestInsertInterval(t *testing.T) {
+	// Intervals which overlap or are adjacent are coalesced.
+	overlaps := func(a, b Item) bool {
+		return b.(interval).lo <= a.(interval).hi+1
+	}
+
+	merge := func(a, b Item) Item {
+		x, y := a.(interval), b.(interval)
+		if y.hi > x.hi {
+			x.hi = y.hi
+		}
+
+		return x
+	}
+
+	tree := New()
+	check := func(insert interval, expected string) {
+		tree.InsertInterval(insert, overlaps, merge)
+
+		var got []interval
+		for it := tree.First(); it != tree.End(); it.Next() {
+			got = append(got, it.Item().(interval))
+		}
+
+		if fmt.Sprint(got) != expected {
+			t.Errorf("After inserting %v, expected %s, got %v", insert, expected, got)
+		}
+	}
+
+	check(interval{10, 20}, "[{10 20}]")
+	check(interval{30, 40}, "[{10 20} {30 40}]")
+	check(interval{50, 60}, "[{10 20} {30 40} {50 60}]")
+	check(interval{15, 25}, "[{10 25} {30 40} {50 60}]")
+	check(interval{41, 45}, "[{10 25} {30 45} {50 60}]")
+	check(interval{0, 5}, "[{0 5} {10 25} {30 45} {50 60}]")
+	check(interval{12, 14}, "[{0 5} {10 25} {30 45} {50 60}]")
+	check(interval{20, 55}, "[{0 5} {10 60}]")
+	check(interval{6, 9}, "[{0 60}]")
+}
+
+func TestPeaks(t *testing.T) {
+	signal := []float64{3, 1, 4, 4, 2, 6, 5, 3, 5, 9}
+	score := func(item Item) float64 { return signal[item.(Int)] }
+
+	tree := New()
+	for i := range signal {
+		tree.Insert(Int(i))
+	}
+
+	// Index 0 is a peak at the start, and index 9 at the end. The plateau at
+	// indices 2 and 3 is not a strict peak.
+	if got := fmt.Sprint(tree.Peaks(score)); got != "[0 5 9]" {
+		t.Errorf("Expected peaks [0 5 9], got %s", got)
+	}
+
+	if got := fmt.Sprint(treeOf(0).Peaks(score)); got != "[0]" {
+		t.Errorf("Expected a single item to be a peak, got %s", got)
+	}
+
+	if len(New().Peaks(score)) != 0 {
+		t.Error("An empty tree has no peaks")
+	}
+}
+
+func TestSplitByCount(t *testing.T) {
+	tree := NewMultiValued()
+	for i := 1; i <= 6; i++ {
+		// Insert i copies of i
+		for j := 0; j < i; j++ {
+			tree.Insert(Int(i))
+		}
+	}
+
+	frequent, rare := tree.SplitByCount(4)
+	checkTree(t, frequent.inner, []int{4, 5, 6})
+	checkTree(t, rare.inner, []int{1, 2, 3})
+
+	frequent, rare = tree.SplitByCount(0)
+	checkTree(t, frequent.inner, []int{1, 2, 3, 4, 5, 6})
+	checkTree(t, rare.inner, []int{})
+}
+
+func TestWindow(t *testing.T) {
+	tree := treeOf(10, 20, 30, 40, 50, 60, 70)
+
+	check := func(target, before, after int, expected string) {
+		if got := fmt.Sprint(tree.Window(Int(target), before, after)); got != expected {
+			t.Errorf("Window(%d, %d, %d) = %s, expected %s", target, before, after, got, expected)
+		}
+	}
+
+	check(40, 2, 2, "[20 30 40 50]")
+	check(45, 2, 2, "[30 40 50 60]")
+	check(10, 2, 3, "[10 20 30]")
+	check(20, 5, 1, "[10 20]")
+	check(70, 2, 5, "[50 60 70]")
+	check(80, 2, 2, "[60 70]")
+	check(0, 2, 2, "[10 20]")
+	check(40, 0, 0, "[]")
+
+	// A flipped tree is windowed in descending order around LowerBound.
+	tree.Flip()
+	check(40, 2, 2, "[60 50 40 30]")
+	check(45, 2, 2, "[60 50 40 30]")
+	check(70, 2, 3, "[70 60 50]")
+	check(10, 2, 5, "[30 20 10]")
+	check(0, 2, 2, "[20 10]")
+	check(80, 2, 2, "[70 60]")
+}
+
+func TestReplaceFunc(t *testing.T) {
+	tree := New()
+	for i, name := range []string{"zero", "one", "two", "three", "four"} {
+		tree.Insert(keyValue{i, name})
+	}
+
+	count := tree.ReplaceFunc(
+		func(item Item) bool { return item.(keyValue).key%2 == 0 },
+		func(item Item) Item {
+			kv := item.(keyValue)
+			return keyValue{kv.key, strings.ToUpper(kv.value)}
+		},
+	)
+
+	if count != 3 {
+		t.Errorf("Expected to replace 3 items, replaced %d", count)
+	}
+
+	var got []string
+	for it := tree.First(); it != tree.End(); it.Next() {
+		got = append(got, it.Item().(keyValue).value)
+	}
+
+	if fmt.Sprint(got) != "[ZERO one TWO three FOUR]" {
+		t.Errorf("Unexpected items after ReplaceFunc: %v", got)
+	}
+}
+
+func TestUniqueAcross(t *testing.T) {
+	result := UniqueAcross(
+		treeOf(1, 2, 3, 10),
+		treeOf(2, 4, 6, 10),
+		treeOf(3, 6, 7, 10),
+		treeOf(),
+	)
+
+	checkTree(t, result.inner, []int{1, 4, 7})
+	checkTree(t, UniqueAcross(treeOf(1, 2)).inner, []int{1, 2})
+	checkTree(t, UniqueAcross().inner, []int{})
+}
+
+func TestSlidingAggregate(t *testing.T) {
+	tree := treeOf(1, 2, 3, 5, 8, 13, 21)
+	add := func(a, b Item) Item { return a.(Int) + b.(Int) }
+	toKey := func(item Item) Int { return item.(Int) }
+
+	check := func(windowSize, step Int, expected string) {
+		if got := fmt.Sprint(tree.SlidingAggregate(windowSize, step, add, toKey)); got != expected {
+			t.Errorf("SlidingAggregate(%d, %d) = %s, expected %s", windowSize, step, got, expected)
+		}
+	}
+
+	// Windows [1, 6), [6, 11), [11, 16), [16, 21), [21, 26)
+	check(5, 5, "[11 8 13 <nil> 21]")
+
+	// Windows [1, 11), [6, 16), [11, 21), [16, 26), [21, 31)
+	check(10, 5, "[19 21 13 21 21]")
+
+	check(100, 100, "[53]")
+	check(0, 1, "[]")
+
+	if New().SlidingAggregate(5, 5, add, toKey) != nil {
+		t.Error("An empty tree has no windows")
+	}
+
+	// The aggregate maintained by a tree plays no part in the windows, which
+	// are always combined with add.
+	weighted := NewWeighted(func(item Item) float64 { return float64(item.(Int)) })
+	for _, i := range []Int{1, 2, 3, 5, 8, 13, 21} {
+		weighted.Insert(i)
+	}
+
+	if got := fmt.Sprint(weighted.SlidingAggregate(5, 5, add, toKey)); got != "[11 8 13 <nil> 21]" {
+		t.Errorf("SlidingAggregate(5, 5) of a weighted tree = %s", got)
+	}
+}
+
+func TestFirstDivergence(t *testing.T) {
+	kvTree := func(items ...keyValue) Tree {
+		tree := New()
+		for _, item := range items {
+			tree.Insert(item)
+		}
+
+		return tree
+	}
+
+	tests := []struct {
+		a, b     Tree
+		item     Item
+		diverged bool
+	}{
+		{treeOf(1, 2, 3), treeOf(0, 1, 2, 3), Int(0), true},
+		{treeOf(1, 2, 4, 5), treeOf(1, 2, 3, 5), Int(3), true},
+		{treeOf(1, 2, 3), treeOf(1, 2, 3, 4), Int(4), true},
+		{treeOf(1, 2, 3, 4), treeOf(1, 2, 3), Int(4), true},
+		{treeOf(1, 2, 3), treeOf(1, 2, 3), nil, false},
+		{treeOf(), treeOf(), nil, false},
+		{kvTree(keyValue{1, "a"}, keyValue{2, "b"}), kvTree(keyValue{1, "a"}, keyValue{2, "B"}), keyValue{2, "b"}, true},
+	}
+
+	for i, test := range tests {
+		item, diverged := FirstDivergence(test.a, test.b)
+		if item != test.item || diverged != test.diverged {
+			t.Errorf("Test %d: got (%v, %v), expected (%v, %v)", i, item, diverged, test.item, test.diverged)
+		}
+	}
+}
+
+func TestSelectRank(t *testing.T) {
+	rng := rand.New(rand.NewSource(44))
+	members := make([]int, 0)
+	tree := New()
+
+	for i := 0; i < 2000; i++ {
+		v := rng.Intn(300)
+		if rng.Float64() < 0.6 {
+			if tree.Insert(Int(v)) {
+				members = append(members, v)
+			}
+		} else if tree.Delete(Int(v)) != nil {
+			for j, m := range members {
+				if m == v {
+					members = append(members[:j], members[j+1:]...)
+					break
+				}
+			}
+		}
+
+		if i%20 != 0 {
+			continue
+		}
+
+		sorted := append([]int(nil), members...)
+		sort.Ints(sorted)
+		for k, expected := range sorted {
+			if item, ok := tree.Select(k); !ok || item != Int(expected) {
+				t.Fatalf("Select(%d) = (%v, %v), expected %d", k, item, ok, expected)
+			}
+		}
+
+		for _, k := range []int{-1, len(sorted)} {
+			if item, ok := tree.Select(k); ok {
+				t.Fatalf("Select(%d) = %v on a tree of size %d", k, item, len(sorted))
+			}
+		}
+
+		for q := -1; q <= 301; q++ {
+			if rank, expected := tree.Rank(Int(q)), sort.SearchInts(sorted, q); rank != expected {
+				t.Fatalf("Rank(%d) = %d, expected %d", q, rank, expected)
+			}
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	var empty Tree
+	if empty.Contains(Int(0)) {
+		t.Errorf("Empty tree contains an item")
+	}
+
+	var emptyMulti MultiValuedTree
+	if emptyMulti.Contains(Int(0)) {
+		t.Errorf("Empty multi-valued tree contains an item")
+	}
+
+	tree := treeOf(1, 3, 5)
+	multi := NewMultiValued()
+	for _, item := range []int{1, 3, 3, 5} {
+		multi.Insert(Int(item))
+	}
+
+	for i := 0; i <= 6; i++ {
+		expected := i%2 == 1
+		if tree.Contains(Int(i)) != expected {
+			t.Errorf("Tree.Contains(%d) != %v", i, expected)
+		}
+		if multi.Contains(Int(i)) != expected {
+			t.Errorf("MultiValuedTree.Contains(%d) != %v", i, expected)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	tree := treeOf(1, 2, 3, 4, 5, 6, 7, 8)
+	clone := tree.Clone()
+
+	tree.Delete(Int(3))
+	tree.Insert(Int(10))
+	clone.Delete(Int(8))
+	clone.Insert(Int(0))
+
+	checkTree(t, tree.inner, []int{1, 2, 4, 5, 6, 7, 8, 10})
+	checkTree(t, clone.inner, []int{0, 1, 2, 3, 4, 5, 6, 7})
+
+	multi := NewMultiValued()
+	for i, key := range []int{2, 1, 2, 2, 3} {
+		multi.Insert(keyValue{key, fmt.Sprint(i)})
+	}
+	multiClone := multi.Clone()
+	multi.Delete(keyValue{key: 1})
+	multiClone.Insert(keyValue{4, "x"})
+
+	checkTreeInvariants(t, multi.inner.root)
+	checkTreeInvariants(t, multiClone.inner.root)
+
+	var values []string
+	for it := multiClone.First(); it != multiClone.End(); it.Next() {
+		values = append(values, it.Item().(keyValue).value)
+	}
+	if strings.Join(values, " ") != "1 0 2 3 4 x" {
+		t.Errorf("Clone reordered items: %v", values)
+	}
+	if multi.Size() != 4 || multiClone.Size() != 6 {
+		t.Errorf("Clones share state: sizes %d and %d", multi.Size(), multiClone.Size())
+	}
+}
+
+func TestDebugValidate(t *testing.T) {
+	tree := treeOf(1, 2, 3, 4, 5, 6, 7)
+	if err := tree.DebugValidate(); err != nil {
+		t.Fatalf("Valid tree failed validation: %v", err)
+	}
+
+	var empty MultiValuedTree
+	if err := empty.DebugValidate(); err != nil {
+		t.Fatalf("Empty tree failed validation: %v", err)
+	}
+
+	// Break the ordering.
+	broken := tree.Clone()
+	broken.inner.root.left.item = Int(100)
+	if err := broken.DebugValidate(); err == nil || !strings.Contains(err.Error(), "out of order") {
+		t.Errorf("Misordered tree passed validation: %v", err)
+	}
+
+	// Break a parent pointer.
+	broken = tree.Clone()
+	broken.inner.root.right.parent = broken.inner.root.left
+	if err := broken.DebugValidate(); err == nil || !strings.Contains(err.Error(), "parent") {
+		t.Errorf("Tree with a bad parent pointer passed validation: %v", err)
+	}
+
+	// Break the black heights.
+	broken = tree.Clone()
+	broken.inner.root.left.black = !broken.inner.root.left.black
+	if err := broken.DebugValidate(); err == nil {
+		t.Errorf("Tree with unequal black heights passed validation")
+	}
+}
+
+func TestPopMinMax(t *testing.T) {
+	var empty Tree
+	if empty.PopMin() != nil || empty.PopMax() != nil {
+		t.Errorf("Popped an item from an empty tree")
+	}
+
+	tree := NewChecked()
+	members := []int{}
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i))
+		members = append(members, i)
+	}
+
+	for len(members) > 0 {
+		if item := tree.PopMin(); item != Int(members[0]) {
+			t.Fatalf("PopMin returned %v, expected %d", item, members[0])
+		}
+		members = members[1:]
+		if len(members) == 0 {
+			break
+		}
+
+		if item := tree.PopMax(); item != Int(members[len(members)-1]) {
+			t.Fatalf("PopMax returned %v, expected %d", item, members[len(members)-1])
+		}
+		members = members[:len(members)-1]
+		checkTree(t, tree.inner, append([]int(nil), members...))
+	}
+
+	if !tree.Empty() {
+		t.Errorf("Tree not empty after popping every item")
+	}
+
+	flipped := treeOf(1, 2, 3)
+	flipped.Flip()
+	if item := flipped.PopMin(); item != Int(3) {
+		t.Errorf("PopMin on a flipped tree returned %v", item)
+	}
+
+	multi := NewMultiValued()
+	for i, key := range []int{1, 1, 2, 2} {
+		multi.Insert(keyValue{key, fmt.Sprint(i)})
+	}
+	if item := multi.PopMin(); item != (keyValue{1, "0"}) {
+		t.Errorf("MultiValuedTree.PopMin returned %v", item)
+	}
+	if item := multi.PopMax(); item != (keyValue{2, "3"}) {
+		t.Errorf("MultiValuedTree.PopMax returned %v", item)
+	}
+	checkTreeInvariants(t, multi.inner.root)
+}
+
+func TestMultiValuedCount(t *testing.T) {
+	var empty MultiValuedTree
+	if n := empty.Count(Int(1)); n != 0 {
+		t.Errorf("Empty tree has %d copies of 1", n)
+	}
+
+	counts := map[int]int{1: 3, 4: 1, 6: 5, 9: 2}
+	tree := NewMultiValued()
+	for key, count := range counts {
+		for i := 0; i < count; i++ {
+			tree.Insert(Int(key))
+		}
+	}
+
+	for key := 0; key <= 10; key++ {
+		if n := tree.Count(Int(key)); n != counts[key] {
+			t.Errorf("Count(%d) = %d, expected %d", key, n, counts[key])
+		}
+	}
+
+	tree.Delete(Int(6))
+	if n := tree.Count(Int(6)); n != 4 {
+		t.Errorf("Count(6) = %d after a delete, expected 4", n)
+	}
+}
+
+func TestEqualRange(t *testing.T) {
+	multi := NewMultiValued()
+	for _, item := range []int{1, 3, 3, 3, 5, 7, 7} {
+		multi.Insert(Int(item))
+	}
+
+	for target := 0; target <= 8; target++ {
+		begin, end := multi.EqualRange(Int(target))
+		if begin != multi.LowerBound(Int(target)) || end != multi.UpperBound(Int(target)) {
+			t.Errorf("MultiValuedTree.EqualRange(%d) disagrees with LowerBound and UpperBound", target)
+		}
+	}
+
+	tree := treeOf(1, 3, 5, 7)
+	for _, flipped := range []bool{false, true} {
+		for target := 0; target <= 8; target++ {
+			begin, end := tree.EqualRange(Int(target))
+			if begin != tree.LowerBound(Int(target)) || end != tree.UpperBound(Int(target)) {
+				t.Errorf("EqualRange(%d) disagrees with LowerBound and UpperBound (flipped: %v)", target, flipped)
+			}
+
+			if found := begin != end; found != tree.Contains(Int(target)) {
+				t.Errorf("EqualRange(%d) is empty: %v (flipped: %v)", target, !found, flipped)
+			}
+		}
+
+		tree.Flip()
+	}
+}
+
+func TestToSlice(t *testing.T) {
+	var empty Tree
+	if items := empty.ToSlice(); items == nil || len(items) != 0 {
+		t.Errorf("ToSlice on an empty tree returned %#v", items)
+	}
+	if items := empty.RangeToSlice(empty.First(), empty.End()); items == nil || len(items) != 0 {
+		t.Errorf("RangeToSlice on an empty tree returned %#v", items)
+	}
+
+	tree := treeOf(5, 1, 4, 2, 3)
+	if items := fmt.Sprint(tree.ToSlice()); items != "[1 2 3 4 5]" {
+		t.Errorf("ToSlice returned %s", items)
+	}
+
+	begin, end := tree.LowerBound(Int(2)), tree.LowerBound(Int(5))
+	if items := fmt.Sprint(tree.RangeToSlice(begin, end)); items != "[2 3 4]" {
+		t.Errorf("RangeToSlice returned %s", items)
+	}
+	if items := tree.RangeToSlice(begin, begin); items == nil || len(items) != 0 {
+		t.Errorf("RangeToSlice on an empty range returned %#v", items)
+	}
+
+	multi := NewMultiValued()
+	for _, item := range []int{2, 1, 2} {
+		multi.Insert(Int(item))
+	}
+	if items := fmt.Sprint(multi.ToSlice()); items != "[1 2 2]" {
+		t.Errorf("MultiValuedTree.ToSlice returned %s", items)
+	}
+}
+
+func TestNewFromSorted(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 4, 7, 8, 15, 16, 100, 1000, 1023, 1025} {
+		items := make([]Item, size)
+		members := make([]int, size)
+		for i := range items {
+			items[i] = Int(i * 3)
+			members[i] = i * 3
+		}
+
+		tree := NewFromSorted(items)
+		checkTree(t, tree.inner, members)
+		if err := tree.DebugValidate(); err != nil {
+			t.Fatalf("Tree of size %d is invalid: %v", size, err)
+		}
+
+		// The tree must remain valid when modified.
+		tree.Insert(Int(1))
+		tree.Delete(Int(0))
+		if err := tree.DebugValidate(); err != nil {
+			t.Fatalf("Tree of size %d is invalid after modification: %v", size, err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(45))
+	for i := 0; i < 200; i++ {
+		n, m := rng.Intn(100), rng.Intn(100)
+		if i%10 == 0 {
+			n = rng.Intn(3)
+		}
+
+		a, b := New(), New()
+		members := []int{}
+		for j := 0; j < n; j++ {
+			a.Insert(Int(j))
+			members = append(members, j)
+		}
+		for j := 0; j < m; j++ {
+			b.Insert(Int(n + j))
+			members = append(members, n+j)
+		}
+
+		merged := Merge(a, b)
+		checkTree(t, merged.inner, members)
+		if err := merged.DebugValidate(); err != nil {
+			t.Fatalf("Merge of trees of sizes %d and %d is invalid: %v", n, m, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Merge of overlapping trees did not panic")
+		}
+	}()
+	Merge(treeOf(1, 5), treeOf(3, 7))
+}
+
+func TestSplit(t *testing.T) {
+	rng := rand.New(rand.NewSource(46))
+	for i := 0; i < 200; i++ {
+		tree := New()
+		members := []int{}
+		for j, n := 0, rng.Intn(200); j < n; j++ {
+			if item := rng.Intn(1000); tree.Insert(Int(item)) {
+				members = append(members, item)
+			}
+		}
+		sort.Ints(members)
+
+		target := rng.Intn(1100) - 50
+		less, rest := tree.Split(Int(target))
+		if !tree.Empty() {
+			t.Fatalf("Split did not empty the receiver")
+		}
+
+		k := sort.SearchInts(members, target)
+		checkTree(t, less.inner, append([]int(nil), members[:k]...))
+		checkTree(t, rest.inner, append([]int(nil), members[k:]...))
+		for _, half := range []Tree{less, rest} {
+			if err := half.DebugValidate(); err != nil {
+				t.Fatalf("Split at %d produced an invalid tree: %v", target, err)
+			}
+		}
+
+		merged := Merge(less, rest)
+		checkTree(t, merged.inner, members)
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	rng := rand.New(rand.NewSource(47))
+	for i := 0; i < 100; i++ {
+		a, b := New(), New()
+		inA, inB := map[int]bool{}, map[int]bool{}
+		for j := rng.Intn(60); j > 0; j-- {
+			item := rng.Intn(80)
+			a.Insert(Int(item))
+			inA[item] = true
+		}
+		for j := rng.Intn(60); j > 0; j-- {
+			item := rng.Intn(80)
+			b.Insert(Int(item))
+			inB[item] = true
+		}
+
+		var union, intersection, difference []int
+		for item := 0; item < 80; item++ {
+			if inA[item] || inB[item] {
+				union = append(union, item)
+			}
+			if inA[item] && inB[item] {
+				intersection = append(intersection, item)
+			}
+			if inA[item] && !inB[item] {
+				difference = append(difference, item)
+			}
+		}
+
+		checkTree(t, SetUnion(a, b).inner, union)
+		checkTree(t, SetIntersection(a, b).inner, intersection)
+		checkTree(t, SetDifference(a, b).inner, difference)
+	}
+
+	a, b := New(), New()
+	a.Insert(keyValue{1, "a"})
+	a.Insert(keyValue{2, "a"})
+	b.Insert(keyValue{2, "b"})
+	b.Insert(keyValue{3, "b"})
+	if items := fmt.Sprint(SetUnion(a, b).ToSlice()); items != "[{1 a} {2 a} {3 b}]" {
+		t.Errorf("SetUnion returned %s", items)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var empty Tree
+	empty.ForEach(func(item Item) bool {
+		t.Errorf("ForEach visited %v in an empty tree", item)
+		return true
+	})
+
+	tree := treeOf(1, 2, 3, 4, 5)
+	var items []Item
+	tree.ForEach(func(item Item) bool {
+		items = append(items, item)
+		return item != Int(3)
+	})
+	if fmt.Sprint(items) != "[1 2 3]" {
+		t.Errorf("ForEach visited %v", items)
+	}
+
+	items = nil
+	tree.ForEachRange(tree.LowerBound(Int(2)), tree.End(), func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+	if fmt.Sprint(items) != "[2 3 4 5]" {
+		t.Errorf("ForEachRange visited %v", items)
+	}
+
+	items = nil
+	tree.ForEachRange(tree.RFirst(), tree.LowerBound(Int(2)), func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+	if fmt.Sprint(items) != "[5 4 3]" {
+		t.Errorf("ForEachRange visited %v in reverse", items)
+	}
+
+	multi := NewMultiValued()
+	for _, i := range []int{2, 1, 2} {
+		multi.Insert(Int(i))
+	}
+	items = nil
+	multi.ForEach(func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+	if fmt.Sprint(items) != "[1 2 2]" {
+		t.Errorf("MultiValuedTree.ForEach visited %v", items)
+	}
+}
+
+func TestDeleteIterator(t *testing.T) {
+	tree := NewChecked()
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i))
+	}
+
+	// Deleting nodes with two children moves items between nodes, so check
+	// that each returned iterator points to the true successor.
+	members := []int{}
+	for it := tree.First(); it != tree.End(); {
+		item := int(it.Item().(Int))
+		if item%3 != 0 {
+			members = append(members, item)
+			it.Next()
+			continue
+		}
+
+		it = tree.DeleteIterator(it)
+		if it.IsValid() && it.Item() != Int(item+1) {
+			t.Fatalf("DeleteIterator(%d) returned an iterator to %v", item, it.Item())
+		}
+	}
+	checkTree(t, tree.inner, members)
+
+	for it := tree.RFirst(); it != tree.REnd(); {
+		item := int(it.Item().(Int))
+		it = tree.DeleteIterator(it)
+		if it.IsValid() && it.Item().(Int) >= Int(item) {
+			t.Fatalf("Reverse DeleteIterator(%d) returned an iterator to %v", item, it.Item())
+		}
+	}
+	if !tree.Empty() {
+		t.Errorf("Deleting every item in reverse left %d items", tree.Size())
+	}
+
+	multi := NewMultiValued()
+	for i, key := range []int{1, 2, 2, 2, 3} {
+		multi.Insert(keyValue{key, fmt.Sprint(i)})
+	}
+	it := multi.LowerBound(keyValue{key: 2})
+	it.Next()
+	it = multi.DeleteIterator(it)
+	if it.Item() != (keyValue{2, "3"}) {
+		t.Errorf("DeleteIterator returned an iterator to %v", it.Item())
+	}
+	if items := fmt.Sprint(multi.ToSlice()); items != "[{1 0} {2 1} {2 3} {3 4}]" {
+		t.Errorf("DeleteIterator removed the wrong duplicate: %s", items)
+	}
+}
+
+func TestInsertHint(t *testing.T) {
+	tree := NewChecked()
+	members := []int{}
+
+	// Ascending inserts hinted with the previous insertion take the fast path.
+	hint := tree.End()
+	for i := 0; i < 200; i += 2 {
+		hint = tree.InsertHint(hint, Int(i))
+		if hint.Item() != Int(i) {
+			t.Fatalf("InsertHint(%d) returned an iterator to %v", i, hint.Item())
+		}
+		members = append(members, i)
+	}
+	checkTree(t, tree.inner, append([]int(nil), members...))
+
+	// Items just before and after the hint.
+	for _, i := range []int{51, 49} {
+		hint, _ := tree.Find(Int(50))
+		if it := tree.InsertHint(hint, Int(i)); it.Item() != Int(i) {
+			t.Fatalf("InsertHint(%d) next to 50 returned an iterator to %v", i, it.Item())
+		}
+		members = append(members, i)
+	}
+
+	// Items far from the hint fall back to a normal insert.
+	for _, i := range []int{1, 197, -5, 500} {
+		if it := tree.InsertHint(tree.First(), Int(i)); it.Item() != Int(i) {
+			t.Fatalf("InsertHint(%d) far from the hint returned an iterator to %v", i, it.Item())
+		}
+		members = append(members, i)
+	}
+
+	// Duplicates are not inserted, whether or not they are next to the hint.
+	for _, i := range []int{50, 52, 100} {
+		hint, _ := tree.Find(Int(50))
+		if it := tree.InsertHint(hint, Int(i)); it.Item() != Int(i) {
+			t.Fatalf("InsertHint of duplicate %d returned an iterator to %v", i, it.Item())
+		}
+	}
+
+	checkTree(t, tree.inner, members)
+}
+
+func TestSizeOnNoOps(t *testing.T) {
+	tree := treeOf(1, 2, 3)
+	for i := 0; i < 10; i++ {
+		if tree.Insert(Int(2)) {
+			t.Fatalf("Inserted a duplicate")
+		}
+		if tree.Size() != 3 {
+			t.Fatalf("Size changed to %d after inserting a duplicate", tree.Size())
+		}
+
+		if tree.Delete(Int(7)) != nil {
+			t.Fatalf("Deleted a missing item")
+		}
+		if _, ok := tree.DeleteOK(Int(-1)); ok {
+			t.Fatalf("DeleteOK reported deleting a missing item")
+		}
+		if tree.Size() != 3 {
+			t.Fatalf("Size changed to %d after deleting a missing item", tree.Size())
+		}
+	}
+	checkTree(t, tree.inner, []int{1, 2, 3})
+
+	var empty Tree
+	empty.Delete(Int(1))
+	empty.PopMin()
+	empty.Clear()
+	if empty.Size() != 0 {
+		t.Errorf("Size of an empty tree changed to %d", empty.Size())
+	}
+
+	multi := NewMultiValued()
+	multi.Insert(Int(1))
+	multi.Delete(Int(2))
+	if multi.Size() != 1 {
+		t.Errorf("Size changed to %d after deleting a missing item", multi.Size())
+	}
+
+	tree.Clear()
+	if tree.Size() != 0 || !tree.Empty() {
+		t.Errorf("Clear left a size of %d", tree.Size())
+	}
+	tree.Insert(Int(4))
+	checkTree(t, tree.inner, []int{4})
+}
+
+func TestPooledTree(t *testing.T) {
+	rng := rand.New(rand.NewSource(48))
+	tree := NewPooled()
+	present := map[int]bool{}
+	for i := 0; i < 5000; i++ {
+		item := rng.Intn(200)
+		if rng.Intn(2) == 0 {
+			if tree.Insert(Int(item)) == present[item] {
+				t.Fatalf("Insert(%d) disagreed with presence", item)
+			}
+			present[item] = true
+		} else {
+			if (tree.Delete(Int(item)) != nil) != present[item] {
+				t.Fatalf("Delete(%d) disagreed with presence", item)
+			}
+			delete(present, item)
+		}
+
+		if i%100 == 0 {
+			members := []int{}
+			for item := range present {
+				members = append(members, item)
+			}
+			checkTree(t, tree.inner, members)
+		}
+	}
+
+	// Deleting and reinserting an item reuses its node.
+	tree.Clear()
+	tree.Insert(Int(0))
+	tree.Insert(Int(1))
+	allocs := testing.AllocsPerRun(100, func() {
+		tree.Delete(Int(1))
+		tree.Insert(Int(1))
+	})
+	if allocs != 0 {
+		t.Errorf("Reinserting into a pooled tree made %v allocations", allocs)
+	}
+
+	tree.Clear()
+	if tree.inner.free != nil {
+		t.Errorf("Clear did not release the free list")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	ints := treeOf(3, 1, 2, 10)
+	data, err := json.Marshal(ints)
+	if err != nil || string(data) != "[1,2,3,10]" {
+		t.Fatalf("Marshaled tree as %s, %v", data, err)
+	}
+
+	decodeInt := func(raw json.RawMessage) (Item, error) {
+		var i Int
+		err := json.Unmarshal(raw, &i)
+		return i, err
+	}
+
+	decoded := NewJSON(decodeInt)
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal %s: %v", data, err)
+	}
+	checkTree(t, decoded.inner, []int{1, 2, 3, 10})
+
+	// Unsorted arrays with duplicates are accepted too.
+	if err := json.Unmarshal([]byte("[5,4,5,1]"), &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal an unsorted array: %v", err)
+	}
+	checkTree(t, decoded.inner, []int{1, 4, 5})
+
+	strs := New()
+	for _, s := range []string{"b", "a", "c"} {
+		strs.Insert(String(s))
+	}
+	data, err = json.Marshal(strs)
+	if err != nil || string(data) != `["a","b","c"]` {
+		t.Fatalf("Marshaled tree as %s, %v", data, err)
+	}
+
+	decoded = NewJSON(func(raw json.RawMessage) (Item, error) {
+		var s String
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	})
+	if err := json.Unmarshal(data, &decoded); err != nil || !decoded.MatchesSlice(strs.ToSlice()) {
+		t.Fatalf("Round trip of %s produced %v, %v", data, decoded.ToSlice(), err)
+	}
+
+	var plain Tree
+	if err := json.Unmarshal(data, &plain); err == nil {
+		t.Errorf("Unmarshaled into a tree without a decoder")
+	}
+
+	decoded = NewJSON(decodeInt)
+	if err := json.Unmarshal([]byte(`[1,"x"]`), &decoded); err == nil {
+		t.Errorf("Unmarshaled an array with an invalid element")
+	}
+
+	decoded = NewJSON(func(raw json.RawMessage) (Item, error) { return nil, nil })
+	if err := json.Unmarshal([]byte("[1,2]"), &decoded); !errors.Is(err, ErrNilItem) || !decoded.Empty() {
+		t.Errorf("Unmarshaling nil items returned %v", err)
+	}
+
+	// Unmarshaling keeps the configuration of the tree.
+	decoded = NewJSON(decodeInt)
+	decoded.inner.pooled = true
+	decoded.Reserve(2)
+	free := decoded.inner.free
+	if err := json.Unmarshal([]byte("[2,1]"), &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal into a pooled tree: %v", err)
+	}
+	if !decoded.inner.pooled || decoded.inner.free != free {
+		t.Errorf("Unmarshaling into a pooled tree lost its free list")
+	}
+	checkTree(t, decoded.inner, []int{1, 2})
+
+	// The decoder must not stop trees from being compared or used as map keys.
+	if !reflect.TypeOf(decoded).Comparable() {
+		t.Fatal("Tree is not comparable")
+	}
+	var a, b interface{} = decoded, decoded
+	if a != b {
+		t.Error("A tree created by NewJSON is not equal to a copy of itself")
+	}
+}
+
+func TestGob(t *testing.T) {
+	gob.Register(Int(0))
+	gob.Register(String(""))
+
+	for _, original := range []Tree{treeOf(), treeOf(5, 3, 9, 1), FromSlice([]Item{String("b"), String("a")})} {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(original); err != nil {
+			t.Fatalf("Failed to encode %v: %v", original.ToSlice(), err)
+		}
+
+		var decoded Tree
+		if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+			t.Fatalf("Failed to decode %v: %v", original.ToSlice(), err)
+		}
+
+		if !decoded.MatchesSlice(original.ToSlice()) {
+			t.Errorf("Round trip of %v produced %v", original.ToSlice(), decoded.ToSlice())
+		}
+		if err := decoded.DebugValidate(); err != nil {
+			t.Errorf("Decoded tree is invalid: %v", err)
+		}
+	}
+
+	var decoded Tree
+	if err := decoded.GobDecode([]byte("garbage")); err == nil {
+		t.Errorf("Decoded garbage")
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode([]Item{Int(1), nil}); err != nil {
+		t.Fatalf("Failed to encode a nil item: %v", err)
+	}
+	if err := decoded.GobDecode(buf.Bytes()); !errors.Is(err, ErrNilItem) || !decoded.Empty() {
+		t.Errorf("Decoding a nil item returned %v", err)
+	}
+
+	// Decoding keeps the configuration of the tree.
+	pooled := NewPooled()
+	pooled.Reserve(2)
+	free := pooled.inner.free
+	data, err := treeOf(2, 1).GobEncode()
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := pooled.GobDecode(data); err != nil {
+		t.Fatalf("Failed to decode into a pooled tree: %v", err)
+	}
+	if !pooled.inner.pooled || pooled.inner.free != free {
+		t.Errorf("Decoding into a pooled tree lost its free list")
+	}
+	checkTree(t, pooled.inner, []int{1, 2})
+
+	// Items inserted after the round trip reuse the pooled nodes.
+	pooled.Delete(Int(1))
+	if allocs := testing.AllocsPerRun(100, func() {
+		pooled.Insert(Int(1))
+		pooled.Delete(Int(1))
+	}); allocs != 0 {
+		t.Errorf("Reinserting into a decoded pooled tree made %v allocations", allocs)
+	}
+}
+
+func TestString(t *testing.T) {
+	var empty Tree
+	if s := empty.String(); s != "(empty)\n" {
+		t.Errorf("Empty tree rendered as %q", s)
+	}
+
+	tree := NewFromSorted([]Item{Int(1), Int(2), Int(3), Int(4)})
+	expected := "B 3\n  L: B 2\n    L: R 1\n  R: B 4\n"
+	if s := tree.String(); s != expected {
+		t.Errorf("Tree rendered as\n%s\nexpected\n%s", s, expected)
+	}
+
+	expected = `digraph rbtree {
+	node [style=filled, fontcolor=white];
+	n0 [label="3", fillcolor=black];
+	n1 [label="2", fillcolor=black];
+	n2 [label="1", fillcolor=red];
+	n1 -> n2 [label="L"];
+	n0 -> n1 [label="L"];
+	n3 [label="4", fillcolor=black];
+	n0 -> n3 [label="R"];
+}
+`
+	if s := tree.Dot(); s != expected {
+		t.Errorf("Tree rendered in DOT as\n%s\nexpected\n%s", s, expected)
+	}
+}
+
+func TestHeight(t *testing.T) {
+	var empty Tree
+	if empty.Height() != 0 || empty.BlackHeight() != 0 {
+		t.Errorf("Empty tree has height %d and black height %d", empty.Height(), empty.BlackHeight())
+	}
+
+	if tree := treeOf(1); tree.Height() != 1 || tree.BlackHeight() != 1 {
+		t.Errorf("Tree of one item has height %d and black height %d", tree.Height(), tree.BlackHeight())
+	}
+
+	if tree := NewFromSorted([]Item{Int(1), Int(2), Int(3), Int(4)}); tree.Height() != 3 || tree.BlackHeight() != 2 {
+		t.Errorf("Tree of four items has height %d and black height %d", tree.Height(), tree.BlackHeight())
+	}
+
+	rng := rand.New(rand.NewSource(49))
+	for i := 0; i < 50; i++ {
+		tree := New()
+		for j := rng.Intn(2000); j > 0; j-- {
+			tree.Insert(Int(rng.Intn(5000)))
+		}
+
+		if tree.Height() > 2*tree.BlackHeight() {
+			t.Fatalf("Tree of size %d has height %d but black height %d", tree.Size(), tree.Height(), tree.BlackHeight())
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	ascending, descending := New(), New()
+	for i := 0; i < 100; i++ {
+		ascending.Insert(Int(i))
+		descending.Insert(Int(99 - i))
+	}
+	balanced := NewFromSorted(ascending.ToSlice())
+
+	if ascending.String() == descending.String() || ascending.String() == balanced.String() {
+		t.Fatalf("Trees unexpectedly have the same shape")
+	}
+	if !Equal(ascending, descending) || !Equal(ascending, balanced) {
+		t.Errorf("Trees with the same items are not equal")
+	}
+	if !Equal(New(), treeOf()) {
+		t.Errorf("Empty trees are not equal")
+	}
+
+	descending.Delete(Int(50))
+	descending.Insert(Int(100))
+	if Equal(ascending, descending) {
+		t.Errorf("Trees with different items are equal")
+	}
+	if Equal(ascending, treeOf(1, 2)) {
+		t.Errorf("Trees with different sizes are equal")
+	}
+
+	a, b := NewMultiValued(), NewMultiValued()
+	for _, i := range []int{1, 2, 2, 3} {
+		a.Insert(Int(i))
+	}
+	for _, i := range []int{3, 2, 1, 2} {
+		b.Insert(Int(i))
+	}
+	if !EqualMultiValued(a, b) {
+		t.Errorf("Multi-valued trees with the same items are not equal")
+	}
+
+	b.Delete(Int(2))
+	b.Insert(Int(3))
+	if EqualMultiValued(a, b) {
+		t.Errorf("Multi-valued trees with different counts are equal")
+	}
+}
+
+func TestReversed(t *testing.T) {
+	wrapped := New()
+	for _, i := range []int{3, 1, 4, 5, 2} {
+		wrapped.Insert(Reversed{Int(i)})
+	}
+
+	var items []Item
+	for it := wrapped.First(); it != wrapped.End(); it.Next() {
+		items = append(items, it.Item().(Reversed).Item)
+	}
+	if fmt.Sprint(items) != "[5 4 3 2 1]" {
+		t.Errorf("Reversed items were iterated as %v", items)
+	}
+	if wrapped.Min() != (Reversed{Int(5)}) {
+		t.Errorf("Min of reversed items is %v", wrapped.Min())
+	}
+	if _, ok := wrapped.Find(Reversed{Int(4)}); !ok || wrapped.Delete(Reversed{Int(4)}) == nil {
+		t.Errorf("Failed to find and delete a reversed item")
+	}
+
+	tree := NewReversed()
+	for _, i := range []int{3, 1, 4, 5, 2} {
+		tree.Insert(Int(i))
+	}
+
+	items = nil
+	for it := tree.First(); it != tree.End(); it.Next() {
+		items = append(items, it.Item())
+	}
+	if fmt.Sprint(items) != "[5 4 3 2 1]" {
+		t.Errorf("NewReversed tree was iterated as %v", items)
+	}
+	if tree.Min() != Int(5) || tree.Max() != Int(1) {
+		t.Errorf("NewReversed tree has Min %v and Max %v", tree.Min(), tree.Max())
+	}
+
+	items = nil
+	tree.ForEach(func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+	if fmt.Sprint(items) != "[5 4 3 2 1]" || fmt.Sprint(tree.ToSlice()) != "[5 4 3 2 1]" {
+		t.Errorf("ForEach and ToSlice of a NewReversed tree gave %v and %v", items, tree.ToSlice())
+	}
+	if items := tree.RangeToSlice(tree.First(), tree.End()); fmt.Sprint(items) != "[5 4 3 2 1]" {
+		t.Errorf("RangeToSlice of a NewReversed tree gave %v", items)
+	}
+
+	if _, ok := tree.Find(Int(4)); !ok || tree.Delete(Int(4)) == nil {
+		t.Errorf("Failed to find and delete an item in a NewReversed tree")
+	}
+}
+
+func TestBytesAndTime(t *testing.T) {
+	tree := New()
+	for _, b := range []Bytes{Bytes("b"), Bytes("ab"), Bytes("a"), Bytes{0xff}, Bytes("")} {
+		tree.Insert(b)
+	}
+
+	if tree.Insert(Bytes(nil)) {
+		t.Errorf("A nil Bytes is not equivalent to an empty one")
+	}
+
+	var items []string
+	for it := tree.First(); it != tree.End(); it.Next() {
+		items = append(items, fmt.Sprintf("%q", it.Item()))
+	}
+	if s := strings.Join(items, " "); s != `"" "a" "ab" "b" "\xff"` {
+		t.Errorf("Bytes were iterated as %s", s)
+	}
+
+	base := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	times := New()
+	for _, hours := range []int{5, -3, 0, 12} {
+		times.Insert(Time(base.Add(time.Duration(hours) * time.Hour)))
+	}
+
+	// The same instant in a different location is equivalent.
+	if times.Insert(Time(base.In(time.FixedZone("X", 3600)))) {
+		t.Errorf("Equal instants in different locations are not equivalent")
+	}
+
+	var hours []int
+	for it := times.First(); it != times.End(); it.Next() {
+		hours = append(hours, int(time.Time(it.Item().(Time)).Sub(base)/time.Hour))
+	}
+	if fmt.Sprint(hours) != "[-3 0 5 12]" {
+		t.Errorf("Times were iterated as %v", hours)
+	}
+}
+
+func TestNumericTypes(t *testing.T) {
+	large := New()
+	values := []uint64{1 << 63, 0, math.MaxUint64, 1<<63 - 1, 1<<63 + 1}
+	for _, v := range values {
+		large.Insert(Uint64(v))
+	}
+
+	expected := "[0 9223372036854775807 9223372036854775808 9223372036854775809 18446744073709551615]"
+	if items := fmt.Sprint(large.ToSlice()); items != expected {
+		t.Errorf("Uint64 items were iterated as %s", items)
+	}
+
+	check := func(name string, items ...Item) {
+		tree := New()
+		for i := len(items) - 1; i >= 0; i-- {
+			tree.Insert(items[i])
+		}
+		if !tree.MatchesSlice(items) {
+			t.Errorf("%s items were iterated as %v", name, tree.ToSlice())
+		}
+	}
+
+	check("Uint", Uint(0), Uint(1), Uint(math.MaxUint))
+	check("Int64", Int64(math.MinInt64), Int64(-1), Int64(0), Int64(math.MaxInt64))
+	check("Float32", Float32(math.Inf(-1)), Float32(-1.5), Float32(0), Float32(math.MaxFloat32))
+}
+
+func TestRangeAggregate(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	tree := NewAggregated(
+		func(item Item) int { return int(item.(Int)) },
+		func(a, b int) int { return a + b },
+		0,
+	)
+
+	var present []int
+	refresh := func() {
+		present = present[:0]
+		for it := tree.First(); it != tree.End(); it.Next() {
+			present = append(present, int(it.Item().(Int)))
+		}
+	}
+
+	for i := 0; i < 2000; i++ {
+		v := Int(rng.Intn(300))
+		switch rng.Intn(4) {
+		case 0:
+			tree.Delete(v)
+		case 1:
+			tree.InsertOrReplace(v)
+		default:
+			tree.Insert(v)
+		}
+
+		if i%20 != 0 {
+			continue
+		}
+
+		refresh()
+		lo, hi := rng.Intn(len(present)+1), rng.Intn(len(present)+1)
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+
+		expected := 0
+		for _, v := range present[lo:hi] {
+			expected += v
+		}
+
+		begin, end := tree.End(), tree.End()
+		if lo < len(present) {
+			begin = tree.LowerBound(Int(present[lo]))
+		}
+		if hi < len(present) {
+			end = tree.LowerBound(Int(present[hi]))
+		}
+
+		if sum := tree.RangeAggregate(begin, end).(int); sum != expected {
+			t.Fatalf("Sum of [%d, %d) is %d, expected %d", lo, hi, sum, expected)
+		}
+	}
+
+	refresh()
+	total := 0
+	for _, v := range present {
+		total += v
+	}
+
+	less, rest := tree.Split(Int(150))
+	merged := Merge(less, rest)
+	if sum := merged.RangeAggregate(merged.First(), merged.End()).(int); sum != total {
+		t.Errorf("Sum after Split and Merge is %d, expected %d", sum, total)
+	}
+
+	merged.Flip()
+	if sum := merged.RangeAggregate(merged.First(), merged.End()).(int); sum != total {
+		t.Errorf("Sum of flipped tree is %d, expected %d", sum, total)
+	}
+}
+
+// A closed range of integers, ordered by low then high endpoint.
+type span struct{ lo, hi Int }
+
+func (s span) Less(than Item) bool {
+	o := than.(span)
+	return s.lo < o.lo || s.lo == o.lo && s.hi < o.hi
+}
+
+func (s span) Endpoints() (lo, hi Item) { return s.lo, s.hi }
+
+func TestSearchOverlapping(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	tree := NewInterval()
+
+	present := map[span]bool{}
+	for i := 0; i < 3000; i++ {
+		lo := Int(rng.Intn(1000))
+		s := span{lo, lo + Int(rng.Intn(50))}
+		if rng.Intn(3) == 0 {
+			tree.Delete(s)
+			delete(present, s)
+		} else {
+			tree.Insert(s)
+			present[s] = true
+		}
+
+		if i%30 != 0 {
+			continue
+		}
+
+		qlo := Int(rng.Intn(1000))
+		qhi := qlo + Int(rng.Intn(100))
+
+		var expected []Item
+		for s := range present {
+			if s.lo <= qhi && qlo <= s.hi {
+				expected = append(expected, s)
+			}
+		}
+		sort.Slice(expected, func(i, j int) bool { return expected[i].Less(expected[j]) })
+
+		got := tree.SearchOverlapping(qlo, qhi)
+		if len(got) != len(expected) {
+			t.Fatalf("SearchOverlapping(%d, %d) found %d intervals, expected %d", qlo, qhi, len(got), len(expected))
+		}
+		for j := range got {
+			if got[j] != expected[j] {
+				t.Fatalf("SearchOverlapping(%d, %d)[%d] is %v, expected %v", qlo, qhi, j, got[j], expected[j])
+			}
+		}
+	}
+
+	if got := NewInterval().SearchOverlapping(Int(0), Int(10)); len(got) != 0 {
+		t.Errorf("Empty tree found intervals %v", got)
+	}
+}
+
+func TestConcurrentTree(t *testing.T) {
+	const writers, readers, N = 4, 4, 500
+	tree := NewConcurrent()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				tree.Insert(Int(w*N + i))
+				if i%2 == 1 {
+					tree.Delete(Int(w*N + i))
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				items := tree.SortedItems()
+				for j := 1; j < len(items); j++ {
+					if !items[j-1].Less(items[j]) {
+						t.Errorf("Snapshot is not sorted")
+						return
+					}
+				}
+				tree.Contains(Int(i))
+				tree.Min()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if tree.Size() != writers*N/2 {
+		t.Errorf("Size is %d, expected %d", tree.Size(), writers*N/2)
+	}
+	for i := 0; i < writers*N; i++ {
+		if tree.Contains(Int(i)) != (i%2 == 0) {
+			t.Errorf("Contains(%d) is %v", i, !(i%2 == 0))
+		}
+	}
+
+	if it, ok := tree.Find(Int(2)); !ok || it.Item() != Int(2) {
+		t.Errorf("Find(2) = (%v, %v)", it, ok)
+	}
+	if it, ok := tree.Find(Int(1)); ok || it.IsValid() {
+		t.Errorf("Find(1) found a deleted item")
+	}
+
+	tree.Clear()
+	if !tree.Empty() || tree.First().IsValid() {
+		t.Errorf("Cleared tree is not empty")
+	}
+}
+
+// Checks the red-black invariants of a persistent subtree and returns its black
+// height.
+func checkPersistentSubtree(t *testing.T, n *pnode) int {
+	if n == nil {
+		return 1
+	}
+
+	if n.isRed() && (n.left.isRed() || n.right.isRed()) {
+		t.Fatalf("Red node %v has a red child", n.item)
+	}
+	if n.left != nil && !n.left.item.Less(n.item) || n.right != nil && !n.item.Less(n.right.item) {
+		t.Fatalf("Children of %v are out of order", n.item)
+	}
+
+	left, right := checkPersistentSubtree(t, n.left), checkPersistentSubtree(t, n.right)
+	if left != right {
+		t.Fatalf("Black heights of children of %v differ: %d != %d", n.item, left, right)
+	}
+
+	if n.black {
+		return left + 1
+	}
+	return left
+}
+
+func TestPersistentTree(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+
+	var versions []PersistentTree
+	var contents [][]Item
+	var tree PersistentTree
+	present := map[Int]bool{}
+
+	for i := 0; i < 2000; i++ {
+		v := Int(rng.Intn(400))
+		if rng.Intn(3) == 0 {
+			var deleted Item
+			tree, deleted = tree.Delete(v)
+			if (deleted != nil) != present[v] {
+				t.Fatalf("Delete(%d) disagreed with presence", v)
+			}
+			delete(present, v)
+		} else {
+			var inserted bool
+			tree, inserted = tree.Insert(v)
+			if inserted == present[v] {
+				t.Fatalf("Insert(%d) disagreed with presence", v)
+			}
+			present[v] = true
+		}
+
+		if tree.Size() != len(present) {
+			t.Fatalf("Size is %d, expected %d", tree.Size(), len(present))
+		}
+		if tree.root.isRed() {
+			t.Fatalf("Root is red")
+		}
+		checkPersistentSubtree(t, tree.root)
+
+		if i%100 == 0 {
+			versions = append(versions, tree)
+			contents = append(contents, tree.ToSlice())
+		}
+	}
+
+	// Every earlier version still holds exactly the items it had.
+	for i, version := range versions {
+		if !reflect.DeepEqual(version.ToSlice(), contents[i]) {
+			t.Fatalf("Version %d changed after later operations", i)
+		}
+	}
+
+	for v := Int(0); v < 400; v++ {
+		if tree.Contains(v) != present[v] {
+			t.Fatalf("Contains(%d) is %v", v, !present[v])
+		}
+	}
+
+	if min, max := tree.Min(), tree.Max(); len(present) > 0 && (min == nil || max == nil || max.Less(min)) {
+		t.Errorf("Min and Max are %v and %v", min, max)
+	}
+	var empty PersistentTree
+	if empty.Min() != nil || !empty.Empty() || len(empty.ToSlice()) != 0 {
+		t.Errorf("Zero PersistentTree is not empty")
+	}
+}
+
+func TestNilItem(t *testing.T) {
+	tree := New()
+	tree.Insert(Int(1))
+
+	if tree.Insert(nil) || tree.Size() != 1 {
+		t.Errorf("Insert(nil) modified the tree")
+	}
+	if old := tree.InsertOrReplace(nil); old != nil || tree.Size() != 1 {
+		t.Errorf("InsertOrReplace(nil) returned %v", old)
+	}
+	if _, it := tree.InsertOrReplaceIter(nil); it != tree.End() {
+		t.Errorf("InsertOrReplaceIter(nil) did not return End")
+	}
+	if it := tree.InsertHint(tree.End(), nil); it != tree.End() || tree.Size() != 1 {
+		t.Errorf("InsertHint(nil) modified the tree")
+	}
+	if tree.InsertDistinct(nil, func(a, b Item) bool { return false }) {
+		t.Errorf("InsertDistinct(nil) returned true")
+	}
+	if it, ok := tree.Find(nil); ok || it != tree.End() {
+		t.Errorf("Find(nil) found an item")
+	}
+	if tree.Contains(nil) || tree.FindItem(nil) != nil {
+		t.Errorf("Contains(nil) or FindItem(nil) found an item")
+	}
+	if tree.Delete(nil) != nil || tree.Size() != 1 {
+		t.Errorf("Delete(nil) modified the tree")
+	}
+
+	if found, comparisons := tree.Probe(nil); found || comparisons != 0 {
+		t.Errorf("Probe(nil) = (%v, %d)", found, comparisons)
+	}
+	if _, _, leftOK, rightOK := tree.ChildrenOf(nil); leftOK || rightOK {
+		t.Errorf("ChildrenOf(nil) found children")
+	}
+	if it := tree.RangeIterator(nil, Int(2)); it.IsValid() {
+		t.Errorf("RangeIterator(nil, 2) is valid")
+	}
+	if it := tree.RangeIterator(Int(0), nil); it.IsValid() {
+		t.Errorf("RangeIterator(0, nil) is valid")
+	}
+	if tree.DeleteRange(nil, Int(2)) != 0 || tree.DeleteRange(Int(0), nil) != 0 || tree.Size() != 1 {
+		t.Errorf("DeleteRange with a nil bound modified the tree")
+	}
+	if _, modified := tree.InsertOrReplaceFunc(nil, func(old, item Item) bool { return true }); modified {
+		t.Errorf("InsertOrReplaceFunc(nil) modified the tree")
+	}
+	if _, ok := tree.DeleteOK(nil); ok {
+		t.Errorf("DeleteOK(nil) deleted an item")
+	}
+	if _, ok := tree.Successor(nil); ok {
+		t.Errorf("Successor(nil) found an item")
+	}
+	if _, ok := tree.Predecessor(nil); ok {
+		t.Errorf("Predecessor(nil) found an item")
+	}
+	if i, ok := tree.View().Find(nil); ok || i != 0 {
+		t.Errorf("View().Find(nil) = (%d, %v)", i, ok)
+	}
+	if begin, end := tree.IndexRange(nil, Int(2)); begin != end {
+		t.Errorf("IndexRange(nil, 2) = [%d, %d)", begin, end)
+	}
+	if begin, end := tree.IndexRange(Int(0), nil); begin != end {
+		t.Errorf("IndexRange(0, nil) = [%d, %d)", begin, end)
+	}
+	if tree.Interpolate(nil, Int(1), 0.5, nil) != nil || tree.Interpolate(Int(1), nil, 0.5, nil) != nil {
+		t.Errorf("Interpolate with a nil bound found items")
+	}
+	if items := tree.Window(nil, 1, 1); items != nil {
+		t.Errorf("Window(nil) = %v", items)
+	}
+
+	// Searches which return positions must do so in either direction.
+	for _, flipped := range []bool{false, true} {
+		if flipped {
+			tree.Flip()
+		}
+
+		if it := tree.LowerBound(nil); it != tree.End() {
+			t.Errorf("LowerBound(nil) did not return End")
+		}
+		if it := tree.UpperBound(nil); it != tree.End() {
+			t.Errorf("UpperBound(nil) did not return End")
+		}
+		if begin, end := tree.EqualRange(nil); begin != tree.End() || end != tree.End() {
+			t.Errorf("EqualRange(nil) did not return End")
+		}
+		if r := tree.Rank(nil); r != 0 {
+			t.Errorf("Rank(nil) = %d", r)
+		}
+		for item := range tree.IterateFrom(nil, true) {
+			t.Errorf("IterateFrom(nil) produced %v", item)
+		}
+
+		it := tree.First()
+		it.Seek(nil)
+		if it != tree.End() {
+			t.Errorf("Seek(nil) did not move to End")
+		}
+	}
+	tree.Flip()
+
+	tree.InsertInterval(nil, func(a, b Item) bool { return true }, func(a, b Item) Item { return a })
+	if tree.InsertSorted([]Item{nil, Int(2), nil}) != 1 || tree.Size() != 2 {
+		t.Errorf("InsertInterval(nil) or InsertSorted with nil items stored nil")
+	}
+	if sorted := NewFromSorted([]Item{nil, Int(1), nil, Int(2)}); !sorted.MatchesSlice([]Item{Int(1), Int(2)}) {
+		t.Errorf("NewFromSorted kept nil items: %v", sorted.ToSlice())
+	}
+
+	in, out := make(chan Item), make(chan Item)
+	go func() {
+		in <- nil
+		in <- Int(3)
+		close(in)
+	}()
+	go tree.MergeChannel(in, out)
+	var merged []Item
+	for item := range out {
+		merged = append(merged, item)
+	}
+	if fmt.Sprint(merged) != "[1 2 3]" {
+		t.Errorf("MergeChannel with a nil item sent %v", merged)
+	}
+
+	less, rest := tree.Split(nil)
+	if less.Size() != 2 || !rest.Empty() {
+		t.Errorf("Split(nil) divided the tree into %v and %v", less.ToSlice(), rest.ToSlice())
+	}
+	tree = less
+
+	counting := NewCounting()
+	counting.Insert(Int(1))
+	counting.Insert(nil)
+	counting.Add(nil, 5)
+	if counting.Size() != 1 || counting.DistinctSize() != 1 || counting.Count(nil) != 0 {
+		t.Errorf("CountingTree stored nil")
+	}
+	if counting.Delete(nil) != nil || counting.Size() != 1 {
+		t.Errorf("CountingTree.Delete(nil) modified the tree")
+	}
+
+	multi := NewMultiValued()
+	multi.Insert(nil)
+	if !multi.Empty() || multi.Contains(nil) || multi.Count(nil) != 0 {
+		t.Errorf("MultiValuedTree stored nil")
+	}
+
+	multi.Insert(Int(1))
+	multi.Insert(Int(1))
+	if multi.Count(nil) != 0 || multi.FindItem(nil) != nil || multi.Delete(nil) != nil || multi.DeleteAll(nil) != 0 {
+		t.Errorf("MultiValuedTree found nil")
+	}
+	if it := multi.LowerBound(nil); it != multi.End() {
+		t.Errorf("MultiValuedTree.LowerBound(nil) did not return End")
+	}
+	if it := multi.UpperBound(nil); it != multi.End() {
+		t.Errorf("MultiValuedTree.UpperBound(nil) did not return End")
+	}
+	if begin, end := multi.EqualRange(nil); begin != multi.End() || end != multi.End() {
+		t.Errorf("MultiValuedTree.EqualRange(nil) did not return End")
+	}
+	if begin, end := multi.FindAll(nil); begin != end {
+		t.Errorf("MultiValuedTree.FindAll(nil) found items")
+	}
+	if _, replaced := multi.ReplaceFirst(nil); replaced || multi.Size() != 2 {
+		t.Errorf("MultiValuedTree.ReplaceFirst(nil) modified the tree")
+	}
+
+	intervals := NewInterval()
+	intervals.Insert(span{Int(1), Int(5)})
+	if found := intervals.SearchOverlapping(nil, Int(3)); found != nil {
+		t.Errorf("SearchOverlapping(nil, 3) = %v", found)
+	}
+	if found := intervals.SearchOverlapping(Int(3), nil); found != nil {
+		t.Errorf("SearchOverlapping(3, nil) = %v", found)
+	}
+
+	concurrent := NewConcurrent()
+	concurrent.Insert(Int(1))
+	if concurrent.Insert(nil) || concurrent.InsertOrReplace(nil) != nil || concurrent.Delete(nil) != nil {
+		t.Errorf("ConcurrentTree stored or deleted nil")
+	}
+	if concurrent.FindItem(nil) != nil || concurrent.Contains(nil) || concurrent.LowerBound(nil).IsValid() {
+		t.Errorf("ConcurrentTree found nil")
+	}
+
+	var persistent PersistentTree
+	if _, inserted := persistent.Insert(nil); inserted || persistent.Contains(nil) {
+		t.Errorf("PersistentTree stored nil")
+	}
+	persistent, _ = persistent.Insert(Int(1))
+	if _, deleted := persistent.Delete(nil); deleted != nil || persistent.FindItem(nil) != nil {
+		t.Errorf("PersistentTree found nil")
+	}
+}
+
+// An Item whose Less method claims that distinct items are each less than the
+// other, which violates antisymmetry but not irreflexivity.
+type symmetricInt int
+
+func (i symmetricInt) Less(than Item) bool {
+	return i != than.(symmetricInt)
+}
+
+func TestNewCheckedAntisymmetry(t *testing.T) {
+	defer func() {
+		msg, ok := recover().(string)
+		if !ok || !strings.Contains(msg, "InsertOrReplace") || !strings.Contains(msg, "each less than the other") {
+			t.Fatalf("Expected a panic describing the inconsistent pair, got %v", msg)
+		}
+	}()
+
+	tree := NewChecked()
+	tree.InsertOrReplace(symmetricInt(1))
+	tree.InsertOrReplace(symmetricInt(2))
+	t.Fatal("Inserting items with an inconsistent Less did not panic")
+}
+
+func TestNewCheckedAntisymmetryInsertDistinct(t *testing.T) {
+	defer func() {
+		msg, ok := recover().(string)
+		if !ok || !strings.Contains(msg, "InsertDistinct") || !strings.Contains(msg, "each less than the other") {
+			t.Fatalf("Expected a panic describing the inconsistent pair, got %v", msg)
+		}
+	}()
+
+	tree := NewChecked()
+	tiebreak := func(a, b Item) bool { return false }
+	tree.InsertDistinct(symmetricInt(1), tiebreak)
+	tree.InsertDistinct(symmetricInt(2), tiebreak)
+	t.Fatal("Inserting items with an inconsistent Less did not panic")
+}
+
+func TestDeleteRange(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	for trial := 0; trial < 50; trial++ {
+		tree := NewChecked()
+		var expected []Item
+		for _, i := range rng.Perm(200) {
+			if i%3 != 0 {
+				tree.Insert(Int(i))
+			}
+		}
+		for i := 0; i < 200; i++ {
+			if i%3 != 0 {
+				expected = append(expected, Int(i))
+			}
+		}
+
+		lo, hi := Int(rng.Intn(220)-10), Int(rng.Intn(220)-10)
+		var kept []Item
+		for _, item := range expected {
+			if item.Less(lo) || !item.Less(hi) {
+				kept = append(kept, item)
+			}
+		}
+
+		if removed := tree.DeleteRange(lo, hi); removed != len(expected)-len(kept) {
+			t.Fatalf("DeleteRange(%d, %d) removed %d items, expected %d", lo, hi, removed, len(expected)-len(kept))
+		}
+		if !tree.MatchesSlice(kept) {
+			t.Fatalf("DeleteRange(%d, %d) left %v, expected %v", lo, hi, tree.ToSlice(), kept)
+		}
+	}
+
+	empty := New()
+	if empty.DeleteRange(Int(0), Int(10)) != 0 {
+		t.Errorf("DeleteRange removed items from an empty tree")
+	}
+}
+
+func TestRemoveIf(t *testing.T) {
+	tree := NewChecked()
+	for _, i := range rand.Perm(500) {
+		tree.Insert(Int(i))
+	}
+
+	if removed := tree.RemoveIf(func(item Item) bool { return item.(Int)%3 == 0 }); removed != 167 {
+		t.Errorf("RemoveIf removed %d items, expected 167", removed)
+	}
+	if removed := tree.RetainIf(func(item Item) bool { return item.(Int) < 250 }); removed != 167 {
+		t.Errorf("RetainIf removed %d items, expected 167", removed)
+	}
+
+	var expected []Item
+	for i := 0; i < 250; i++ {
+		if i%3 != 0 {
+			expected = append(expected, Int(i))
+		}
+	}
+	if !tree.MatchesSlice(expected) {
+		t.Errorf("Tree is %v, expected %v", tree.ToSlice(), expected)
+	}
+
+	if removed := tree.RemoveIf(func(Item) bool { return true }); removed != len(expected) || !tree.Empty() {
+		t.Errorf("Removing every item left %d items", tree.Size())
+	}
+}
+
+func TestInsertAll(t *testing.T) {
+	tests := []struct {
+		dst, src []int
+		inserted int
+	}{
+		{[]int{}, []int{1, 2, 3}, 3},
+		{[]int{1, 2, 3}, []int{}, 0},
+		{[]int{1, 2, 3}, []int{7, 8, 9}, 3},
+		{[]int{7, 8, 9}, []int{1, 2, 3}, 3},
+		{[]int{1, 3, 5, 7}, []int{0, 2, 3, 4, 7, 8}, 4},
+		{[]int{2, 4}, []int{1, 2, 3, 4, 5}, 3},
+	}
+
+	for _, test := range tests {
+		dst, src := NewChecked(), New()
+		present := map[int]bool{}
+		for _, i := range test.dst {
+			dst.Insert(Int(i))
+			present[i] = true
+		}
+		for _, i := range test.src {
+			src.Insert(Int(i))
+			present[i] = true
+		}
+
+		if inserted := dst.InsertAll(src); inserted != test.inserted {
+			t.Errorf("InsertAll(%v) into %v inserted %d items, expected %d", test.src, test.dst, inserted, test.inserted)
+		}
+
+		var expected []Item
+		for i := 0; i < 10; i++ {
+			if present[i] {
+				expected = append(expected, Int(i))
+			}
+		}
+		if !dst.MatchesSlice(expected) {
+			t.Errorf("InsertAll(%v) into %v produced %v", test.src, test.dst, dst.ToSlice())
+		}
+
+		// The source is unchanged and shares no nodes with the destination.
+		dst.Clear()
+		if src.Size() != len(test.src) || src.DebugValidate() != nil {
+			t.Errorf("InsertAll modified its source %v", test.src)
+		}
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	tree := NewMultiValued()
+	for _, kv := range []keyValue{{2, "a"}, {5, "b"}, {2, "c"}, {7, "d"}, {2, "e"}} {
+		tree.Insert(kv)
+	}
+
+	tests := []struct {
+		key    int
+		values string
+	}{
+		{1, ""},
+		{5, "b"},
+		{2, "ace"},
+	}
+
+	for _, test := range tests {
+		values := ""
+		for it, end := tree.FindAll(keyValue{key: test.key}); it != end; it.Next() {
+			values += it.Item().(keyValue).value
+		}
+
+		if values != test.values {
+			t.Errorf("FindAll(%d) visited %q, expected %q", test.key, values, test.values)
+		}
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	rng := rand.New(rand.NewSource(13))
+	tree := NewMultiValued()
+	for i := 0; i < 1000; i++ {
+		tree.Insert(Int(rng.Intn(50)))
+	}
+
+	for key := Int(-1); key <= 50; key++ {
+		size, count := tree.Size(), tree.Count(key)
+		if deleted := tree.DeleteAll(key); deleted != count {
+			t.Fatalf("DeleteAll(%d) deleted %d items, expected %d", key, deleted, count)
+		}
+		if tree.Contains(key) || tree.Size() != size-count {
+			t.Fatalf("DeleteAll(%d) left %d copies and size %d, expected size %d", key, tree.Count(key), tree.Size(), size-count)
+		}
+		if err := tree.DebugValidate(); err != nil {
+			t.Fatalf("DeleteAll(%d) corrupted the tree: %v", key, err)
+		}
+	}
+
+	if !tree.Empty() {
+		t.Errorf("Deleting every key left %d items", tree.Size())
+	}
+}
+
+func TestSuccessorPredecessorOfItem(t *testing.T) {
+	tree := treeOf(10, 20, 30, 40)
+
+	tests := []struct {
+		item       Int
+		pred, succ Item
+	}{
+		{5, nil, Int(10)},
+		{10, nil, Int(20)},
+		{15, Int(10), Int(20)},
+		{20, Int(10), Int(30)},
+		{40, Int(30), nil},
+		{45, Int(40), nil},
+	}
+
+	for _, test := range tests {
+		if succ, ok := tree.Successor(test.item); succ != test.succ || ok != (test.succ != nil) {
+			t.Errorf("Successor(%d) = (%v, %v), expected %v", test.item, succ, ok, test.succ)
+		}
+		if pred, ok := tree.Predecessor(test.item); pred != test.pred || ok != (test.pred != nil) {
+			t.Errorf("Predecessor(%d) = (%v, %v), expected %v", test.item, pred, ok, test.pred)
+		}
+	}
+
+	if _, ok := New().Successor(Int(1)); ok {
+		t.Errorf("Empty tree has a successor")
+	}
+}
+
+func TestInsertSorted(t *testing.T) {
+	tree, batch := sortedBatch(100)
+
+	// Overlap the batch with existing items, which are skipped.
+	batch = append([]Item{Int(0), Int(0)}, batch...)
+	batch = append(batch, Int(500), nil, Int(450))
+	if inserted := tree.InsertSorted(batch); inserted != 202 {
+		t.Errorf("InsertSorted inserted %d items, expected 202", inserted)
+	}
+
+	var expected []Item
+	for i := 0; i < 400; i++ {
+		if i < 200 || i%2 == 1 {
+			expected = append(expected, Int(i))
+		}
+	}
+	expected = append(expected, Int(450), Int(500))
+	if !tree.MatchesSlice(expected) {
+		t.Errorf("InsertSorted produced %v", tree.ToSlice())
+	}
+	if err := tree.DebugValidate(); err != nil {
+		t.Errorf("InsertSorted corrupted the tree: %v", err)
+	}
+
+	empty := New()
+	if empty.InsertSorted(nil) != 0 {
+		t.Errorf("Inserting an empty batch inserted items")
+	}
+}
+
+func TestInsertOrReplaceSemantics(t *testing.T) {
+	tree := New()
+	tree.Insert(keyValue{1, "one"})
+
+	// InsertOrReplace swaps in the new payload under the same key.
+	if old := tree.InsertOrReplace(keyValue{1, "uno"}); old != (keyValue{1, "one"}) {
+		t.Errorf("InsertOrReplace returned %v", old)
+	}
+	if item := tree.FindItem(keyValue{key: 1}); item != (keyValue{1, "uno"}) || tree.Size() != 1 {
+		t.Errorf("Tree holds %v after InsertOrReplace", item)
+	}
+
+	samePayload := func(old, item Item) bool {
+		return old.(keyValue).value == item.(keyValue).value
+	}
+
+	if old, modified := tree.InsertOrReplaceFunc(keyValue{1, "ein"}, samePayload); modified || old != (keyValue{1, "uno"}) {
+		t.Errorf("InsertOrReplaceFunc replaced an unequal item: (%v, %v)", old, modified)
+	}
+	if item := tree.FindItem(keyValue{key: 1}); item != (keyValue{1, "uno"}) {
+		t.Errorf("Tree holds %v after a refused replacement", item)
+	}
+
+	if old, modified := tree.InsertOrReplaceFunc(keyValue{1, "uno"}, samePayload); !modified || old != (keyValue{1, "uno"}) {
+		t.Errorf("InsertOrReplaceFunc did not replace an equal item: (%v, %v)", old, modified)
+	}
+	if old, modified := tree.InsertOrReplaceFunc(keyValue{2, "two"}, samePayload); !modified || old != nil || tree.Size() != 2 {
+		t.Errorf("InsertOrReplaceFunc did not insert a new key: (%v, %v)", old, modified)
+	}
+}
+
+func TestReplaceFirst(t *testing.T) {
+	tree := NewMultiValued()
+	for _, kv := range []keyValue{{1, "a"}, {3, "b"}, {3, "c"}, {5, "d"}} {
+		tree.Insert(kv)
+	}
+
+	if old, ok := tree.ReplaceFirst(keyValue{3, "B"}); !ok || old != (keyValue{3, "b"}) {
+		t.Errorf("ReplaceFirst returned (%v, %v), expected the first duplicate", old, ok)
+	}
+	if old, ok := tree.ReplaceFirst(keyValue{4, "e"}); ok || old != nil {
+		t.Errorf("ReplaceFirst of an absent key returned (%v, %v)", old, ok)
+	}
+
+	values := ""
+	for it := tree.First(); it != tree.End(); it.Next() {
+		values += it.Item().(keyValue).value
+	}
+	if values != "aBced" || tree.Size() != 5 {
+		t.Errorf("Tree holds %q, expected \"aBced\"", values)
+	}
+	if err := tree.DebugValidate(); err != nil {
+		t.Errorf("ReplaceFirst corrupted the tree: %v", err)
+	}
+
+	var empty MultiValuedTree
+	if _, ok := empty.ReplaceFirst(Int(1)); ok || empty.Size() != 1 {
+		t.Errorf("ReplaceFirst did not insert into an empty tree")
+	}
+}
+
+func TestReserve(t *testing.T) {
+	unpooled := New()
+	unpooled.Reserve(10)
+	if unpooled.inner.free != nil {
+		t.Errorf("Reserve filled the free list of an unpooled tree")
+	}
+
+	freeLen := func(tree *Tree) int {
+		n := 0
+		for f := tree.inner.free; f != nil; f = f.right {
+			n += 1
+		}
+		return n
+	}
+
+	tree := NewPooled()
+	tree.Reserve(10)
+	tree.Reserve(4)
+	if n := freeLen(&tree); n != 10 {
+		t.Errorf("Free list has %d nodes after reserving 10, expected 10", n)
+	}
+
+	allocs := testing.AllocsPerRun(1, func() {
+		for i := 0; i < 10; i++ {
+			tree.Insert(Int(i))
+		}
+	})
+	if allocs != 0 || tree.Size() != 10 || freeLen(&tree) != 0 {
+		t.Errorf("Inserting into reserved nodes made %v allocations", allocs)
+	}
+
+	tree.Reserve(5)
+	tree.Clear()
+	if freeLen(&tree) != 0 {
+		t.Errorf("Clear kept the reserved nodes")
+	}
+}
+
+func TestDebugWalk(t *testing.T) {
+	tree := NewFromSorted([]Item{Int(1), Int(2), Int(3), Int(4)})
+
+	tests := []struct {
+		order    TraversalOrder
+		expected string
+	}{
+		{PreOrder, "B3@0 B2@1 R1@2 B4@1 "},
+		{InOrder, "R1@2 B2@1 B3@0 B4@1 "},
+		{PostOrder, "R1@2 B2@1 B4@1 B3@0 "},
+	}
+
+	for _, test := range tests {
+		var b strings.Builder
+		tree.DebugWalk(test.order, func(item Item, black bool, depth int) {
+			color := "R"
+			if black {
+				color = "B"
+			}
+			fmt.Fprintf(&b, "%s%v@%d ", color, item, depth)
+		})
+
+		if b.String() != test.expected {
+			t.Errorf("Walk in order %d visited %q, expected %q", test.order, b.String(), test.expected)
+		}
+	}
+
+	var empty Tree
+	empty.DebugWalk(PreOrder, func(Item, bool, int) {
+		t.Errorf("Walk of an empty tree visited a node")
+	})
+}
+
+func TestInsertAllPooled(t *testing.T) {
+	for _, offset := range []int{100, -100} {
+		tree := NewPooled()
+		for i := 0; i < 10; i++ {
+			tree.Insert(Int(i))
+		}
+		tree.Delete(Int(9))
+
+		other := New()
+		for i := 0; i < 5; i++ {
+			other.Insert(Int(offset + i))
+		}
+
+		if inserted := tree.InsertAll(other); inserted != 5 {
+			t.Fatalf("InsertAll inserted %d items, expected 5", inserted)
+		}
+
+		// A node left on the free list while linked into the tree would be
+		// reused by these insertions, corrupting the tree.
+		for i := 50; i < 60; i++ {
+			tree.Insert(Int(i))
+		}
+		if tree.Size() != 24 {
+			t.Errorf("Size is %d after InsertAll and Insert, expected 24", tree.Size())
+		}
+		if err := tree.DebugValidate(); err != nil {
+			t.Errorf("Insert after InsertAll corrupted the tree: %v", err)
+		}
+	}
+}
+
+// Precompute random numbers
+func randRange(size, seed int) (slice []Int) {
+	rng := rand.New(rand.NewSource(int64(seed)))
+	slice = make([]Int, size)
+	for i := 0; i < size; i++ {
+		slice[i] = Int(rng.Int())
+	}
+
+	return
+}
+
+// Build a large tree of random integers.
+func BenchmarkRBInsert(b *testing.B) {
+	ints := randRange(1<<16, 43)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree := New()
+		for _, n := range ints {
+			tree.Insert(n)
+		}
+	}
+}
+
+// Build a large tree of random integers, then delete every element one
+// by one.
+func BenchmarkRBDelete(b *testing.B) {
+	ints := randRange(1<<16, 43)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// Build the tree
+		b.StopTimer()
+		tree := New()
+		for _, n := range ints {
+			tree.Insert(n)
+		}
+		b.StartTimer()
+
+		// Delete every item in the tree
+		for _, n := range ints {
+			tree.Delete(n)
+		}
+	}
+}
+
+// Interleave Min and Max queries with inserts into a large tree.
+func BenchmarkRBMinMax(b *testing.B) {
+	ints := randRange(1<<16, 43)
+	tree := New()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Insert(ints[i%len(ints)])
+		tree.Min()
+		tree.Max()
+	}
+}
+
+// Look up random items in a tree of a million integers, optionally laid out
+// with OptimizeForReads first.
+func benchmarkFindLarge(b *testing.B, optimize bool) {
+	ints := randRange(1<<20, 43)
+	tree := New()
+	for _, n := range ints {
+		tree.Insert(n)
+	}
+	if optimize {
+		tree.OptimizeForReads()
+	}
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Find(ints[rng.Intn(len(ints))])
+	}
+}
+
+func BenchmarkRBFindLarge(b *testing.B) {
+	benchmarkFindLarge(b, false)
+}
+
+// Same as BenchmarkRBFindLarge, but on a tree laid out by OptimizeForReads.
+func BenchmarkRBFindLargeOptimized(b *testing.B) {
+	benchmarkFindLarge(b, true)
+}
+
+// Repeatedly delete an item from a large tree and insert another.
+func benchmarkChurn(b *testing.B, tree Tree) {
+	ints := randRange(1<<16, 43)
+	for _, n := range ints[:len(ints)/2] {
+		tree.Insert(n)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Delete(ints[i%(len(ints)/2)])
+		tree.Insert(ints[len(ints)/2+i%(len(ints)/2)])
+		tree.Delete(ints[len(ints)/2+i%(len(ints)/2)])
+		tree.Insert(ints[i%(len(ints)/2)])
+	}
+}
+
+func BenchmarkRBChurn(b *testing.B) {
+	benchmarkChurn(b, New())
+}
+
+// Same as BenchmarkRBChurn, but recycles deleted nodes.
+func BenchmarkPooledChurn(b *testing.B) {
+	benchmarkChurn(b, NewPooled())
+}
+
+// Build a large pooled tree of random integers, optionally reserving every
+// node first. The integers are boxed in advance, so that only the nodes are
+// allocated.
+func benchmarkPooledInsert(b *testing.B, reserve bool) {
+	var items []Item
+	for _, n := range randRange(1<<16, 43) {
+		items = append(items, n)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree := NewPooled()
+		if reserve {
+			tree.Reserve(len(items))
+		}
+		for _, item := range items {
+			tree.Insert(item)
+		}
+	}
+}
+
+func BenchmarkPooledInsert(b *testing.B) {
+	benchmarkPooledInsert(b, false)
+}
+
+// Same as BenchmarkPooledInsert, but reserves every node before inserting.
+func BenchmarkPooledReserveInsert(b *testing.B) {
+	benchmarkPooledInsert(b, true)
+}
+
+// Returns a tree of the even integers in [0, 2size), and a sorted batch of the
+// odd integers in [0, 4size), which interleaves with the tree and then extends
+// past its maximum.
+func sortedBatch(size int) (Tree, []Item) {
+	tree := New()
+	batch := make([]Item, 0, 2*size)
+	for i := 0; i < 2*size; i++ {
+		if i < size {
+			tree.Insert(Int(2 * i))
+		}
+		batch = append(batch, Int(2*i+1))
+	}
+
+	return tree, batch
+}
+
+// Insert a sorted batch into a large tree with InsertSorted.
+func BenchmarkRBInsertSorted(b *testing.B) {
+	base, batch := sortedBatch(1 << 15)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree := base.Clone()
+		b.StartTimer()
+
+		tree.InsertSorted(batch)
+	}
+}
+
+// Insert a sorted batch into a large tree one item at a time, for comparison
+// with BenchmarkRBInsertSorted.
+func BenchmarkRBInsertSortedOneByOne(b *testing.B) {
+	base, batch := sortedBatch(1 << 15)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree := base.Clone()
+		b.StartTimer()
+
+		for _, item := range batch {
+			tree.Insert(item)
 		}
 	}
 }
@@ -1,10 +1,27 @@
 package rbtree
 
+import (
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+)
+
 // A red-black tree whose items are unique.
 //
 // See MultiValuedTree for a red-black tree which allows duplicate items.
 type Tree struct {
 	inner tree
+
+	// If true, the navigation methods treat the tree as if it were sorted in
+	// descending order. See Flip.
+	reversed bool
+
+	// If true, the tree is validated after every modification. See NewChecked.
+	checked bool
+
+	// Converts the elements of a JSON array into items. See NewJSON.
+	decoder *jsonDecoder
 }
 
 // Returns a fully initialized red-black tree.
@@ -12,22 +29,131 @@ func New() Tree {
 	return Tree{}
 }
 
+// Returns a red-black tree which checks every one of its nodes after each
+// modification, and panics as soon as the ordering or the red-black invariants
+// are violated. The panic names the operation which broke the tree.
+//
+// Before each insertion, the tree also compares the new item in both
+// directions with the items on its search path, and panics if any two are each
+// less than the other, since such a Less method would silently corrupt the
+// tree. The panic describes the offending pair.
+//
+// This is a debugging aid for developing new Item types; it makes every
+// modification take O(n) time, so it should never be used in production.
+func NewChecked() Tree {
+	return Tree{checked: true}
+}
+
+// Returns an empty red-black tree which is viewed in descending order, as if
+// Flip had been called on it: Min returns the maximum item and iteration
+// proceeds from the largest item to the smallest. Items are stored and queried
+// unwrapped, unlike with Reversed.
+func NewReversed() Tree {
+	return Tree{reversed: true}
+}
+
+// Returns a tree containing the items in the given slice, discarding any
+// duplicates.
+//
+// Runs in O(n log n) time.
+func FromSlice(items []Item) Tree {
+	t, _ := FromSliceStats(items)
+	return t
+}
+
+// Returns a tree containing the items in the given slice, along with the number
+// of duplicate items which were discarded. When several items are equivalent,
+// the first one in the slice is kept. nil entries are skipped without being
+// counted.
+//
+// Runs in O(n log n) time.
+func FromSliceStats(items []Item) (t Tree, dropped int) {
+	for _, item := range items {
+		if item != nil && !t.Insert(item) {
+			dropped += 1
+		}
+	}
+
+	return
+}
+
+// Returns a tree containing the keys of the given map, each converted to an
+// Item with wrap.
+//
+// Runs in O(n log n) time.
+func FromMapKeys[K comparable](m map[K]struct{}, wrap func(K) Item) Tree {
+	items := make([]Item, 0, len(m))
+	for k := range m {
+		items = append(items, wrap(k))
+	}
+
+	return FromSlice(items)
+}
+
+// Returns a tree containing the items in the given slice, which must be sorted
+// in ascending order and contain no equivalent items. The tree is built
+// directly from the slice without comparing any items, so if the slice is not
+// sorted and unique, the tree will misbehave; use FromSlice for arbitrary
+// slices. nil entries are skipped.
+//
+// Runs in O(n) time.
+func NewFromSorted(items []Item) Tree {
+	if slices.Contains(items, nil) {
+		items = slices.DeleteFunc(slices.Clone(items), func(item Item) bool { return item == nil })
+	}
+
+	return Tree{inner: buildSorted(items)}
+}
+
+// Returns a tree containing the items of both a and b, every item of which
+// must be less than every item of b. Rather than inserting the items of one
+// tree into the other, Merge joins the shorter tree into the spine of the
+// taller. Merge panics if the maximum of a is not less than the minimum of b.
+//
+// The result is viewed in the same order as a, and is checked if either tree
+// is. Neither a nor b may be used after the call, since the result shares their
+// nodes.
+//
+// Runs in O(log n) time.
+func Merge(a, b Tree) Tree {
+	if !a.Empty() && !b.Empty() && !a.inner.max.item.Less(b.inner.min.item) {
+		panic("rbtree: Merge of trees whose items overlap")
+	}
+
+	merged := a
+	merged.checked = a.checked || b.checked
+	merged.inner = merge(a.inner, b.inner)
+	merged.check("Merge")
+	return merged
+}
+
 // Returns true if the number of items in the tree is zero
 func (t Tree) Empty() bool {
 	return t.inner.Empty()
 }
 
-// Returns the minimum value in the tree or nil if the tree is empty.
+// Returns the minimum value in the tree or nil if the tree is empty. First
+// returns an Iterator to the same item, from which the rest of the tree can be
+// visited in ascending order.
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t Tree) Min() Item {
+	if t.reversed {
+		return t.inner.Max()
+	}
+
 	return t.inner.Min()
 }
 
-// Returns the maximum value in the tree or nil if the tree is empty.
+// Returns the maximum value in the tree or nil if the tree is empty. Last
+// returns an Iterator to the same item.
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t Tree) Max() Item {
+	if t.reversed {
+		return t.inner.Min()
+	}
+
 	return t.inner.Max()
 }
 
@@ -41,19 +167,143 @@ func (t Tree) Size() int {
 //
 // Runs in O(log n) time.
 func (t *Tree) Insert(item Item) bool {
+	defer t.check("Insert")
+	t.checkLess("Insert", item)
+
 	return t.inner.InsertUnique(item)
 }
 
+// Inserts an item into the tree if an equivalent one does not already exist,
+// using hint to avoid searching the tree. If the item belongs immediately
+// before or after the item hint points to, or after the last item if hint is
+// End, it is linked in place without a descent from the root; otherwise,
+// InsertHint falls back to Insert. Returns an Iterator to the inserted item, or
+// to the existing equivalent item if there was one.
+//
+// When inserting items in ascending order, passing the Iterator returned by
+// the previous call (or Last) as the hint makes each insertion take O(1)
+// amortized time.
+//
+// Runs in O(log n) time.
+func (t *Tree) InsertHint(hint Iterator, item Item) Iterator {
+	defer t.check("InsertHint")
+	t.checkLess("InsertHint", item)
+
+	n, _ := t.inner.insertHint(hint.node, item)
+	return t.iter(n)
+}
+
+// Inserts an item into the tree, using tiebreak to order it relative to any
+// items which are equivalent to it according to Less. tiebreak(a, b) must
+// report whether a should be placed before b, and define a strict weak
+// ordering on items which are equivalent under Less. Returns false and does not
+// modify the tree if the item is equivalent to an existing one under both Less
+// and tiebreak.
+//
+// This emulates a composite key of (Less, tiebreak) without changing the Item
+// type. Items which are equivalent under Less are iterated in tiebreak order,
+// provided they were all inserted with InsertDistinct and the same tiebreak.
+// Since other methods only use Less, Find and Delete locate an arbitrary one of
+// the equivalent items, and Insert will refuse to add another.
+//
+// Runs in O(log n) time.
+func (t *Tree) InsertDistinct(item Item, tiebreak func(a, b Item) bool) bool {
+	defer t.check("InsertDistinct")
+	t.checkLess("InsertDistinct", item)
+
+	if item == nil {
+		return false
+	}
+
+	if t.Empty() {
+		t.inner.insertAt(item, nil, equalTo)
+		return true
+	}
+
+	for n := t.inner.root; ; {
+		var ord ordering
+		switch {
+		case item.Less(n.item), !n.item.Less(item) && tiebreak(item, n.item):
+			ord = lessThan
+		case n.item.Less(item), tiebreak(n.item, item):
+			ord = greaterThan
+		default:
+			return false
+		}
+
+		child := n.left
+		if ord == greaterThan {
+			child = n.right
+		}
+
+		if child == nilChild {
+			t.inner.insertAt(item, n, ord)
+			return true
+		}
+
+		n = child
+	}
+}
+
 // Inserts an item into the tree, or replaces an equivalent item if one exists.
 // Returns the item which was previously in the tree, or nil if none was found.
 //
+// Equivalence is decided by Less alone, so an item whose Less compares only a
+// key replaces the stored item with the same key, whatever its other fields:
+// the tree then holds the new item, with its new payload, in the old item's
+// place. Use InsertOrReplaceFunc to replace only items which are equal in some
+// stricter sense.
+//
 // Runs in O(log n) time.
 func (t *Tree) InsertOrReplace(item Item) Item {
+	defer t.check("InsertOrReplace")
+	t.checkLess("InsertOrReplace", item)
+
 	return t.inner.InsertOrReplace(item)
 }
 
+// Inserts an item into the tree if no equivalent item exists, or replaces the
+// equivalent item old if equal(old, item) returns true. Returns the equivalent
+// item which was in the tree, or nil if there was none, and whether the tree
+// was modified. If equal returns false, the tree keeps old and is unchanged.
+//
+// Runs in O(log n) time.
+func (t *Tree) InsertOrReplaceFunc(item Item, equal func(old, item Item) bool) (old Item, modified bool) {
+	defer t.check("InsertOrReplaceFunc")
+	t.checkLess("InsertOrReplaceFunc", item)
+
+	place, inserted := t.inner.insertUnique(item)
+	switch {
+	case place == nil:
+		return nil, false
+	case inserted:
+		return nil, true
+	case !equal(place.item, item):
+		return place.item, false
+	}
+
+	old, place.item = place.item, item
+	updateAggregatesFrom(place)
+	return old, true
+}
+
+// Inserts an item into the tree, or replaces an equivalent item if one exists.
+// Returns the item which was previously in the tree, or nil if none was found,
+// along with an Iterator pointing to the new item.
+//
+// Runs in O(log n) time.
+func (t *Tree) InsertOrReplaceIter(item Item) (old Item, it Iterator) {
+	defer t.check("InsertOrReplaceIter")
+	t.checkLess("InsertOrReplaceIter", item)
+
+	old, n := t.inner.insertOrReplace(item)
+	return old, t.iter(n)
+}
+
 // Removes all items from the tree.
 func (t *Tree) Clear() {
+	defer t.check("Clear")
+
 	t.inner.Clear()
 }
 
@@ -62,7 +312,8 @@ func (t *Tree) Clear() {
 //
 // Runs in O(log n) time.
 func (t Tree) Find(item Item) (Iterator, bool) {
-	return t.inner.Find(item)
+	it, ok := t.inner.Find(item)
+	return t.iter(it.node), ok
 }
 
 // Searches the tree, returning the Item if the search was successful, or nil if
@@ -77,40 +328,179 @@ func (t Tree) FindItem(item Item) Item {
 	}
 }
 
+// Returns true if the tree contains an item equivalent to item. Unlike Find,
+// Contains does not build an Iterator.
+//
+// Runs in O(log n) time.
+func (t Tree) Contains(item Item) bool {
+	return t.inner.Contains(item)
+}
+
 // Delete looks for an item equivalent to target in the tree and deletes
 // it, returning the value that was present in the tree. If no item was found,
 // Delete returns nil and does not modify the tree.
 //
 // Runs in O(log n) time.
 func (t *Tree) Delete(item Item) Item {
+	defer t.check("Delete")
+
 	return t.inner.Delete(item)
 }
 
+// Deletes the item pointed to by it, which must be a valid Iterator into this
+// tree, without searching for it. Returns an Iterator to the item which
+// followed the deleted one, in the direction it steps in, so that a loop can
+// continue from there:
+//
+//	for it := tree.First(); !it.AtEnd(); {
+//		if shouldDelete(it.Item()) {
+//			it = tree.DeleteIterator(it)
+//		} else {
+//			it.Next()
+//		}
+//	}
+//
+// Every other Iterator into the tree is invalidated.
+//
+// Runs in O(log n) time.
+func (t *Tree) DeleteIterator(it Iterator) Iterator {
+	defer t.check("DeleteIterator")
+
+	return t.inner.removeAt(it.node, it.reversed)
+}
+
+// Same as Delete, but also returns true if an item was found and deleted, or
+// false if the tree was not modified. Since nil is never stored in a tree, the
+// bool carries the same information as a non-nil result; it is provided for
+// callers which prefer the comma-ok form.
+//
+// Runs in O(log n) time.
+func (t *Tree) DeleteOK(item Item) (Item, bool) {
+	defer t.check("DeleteOK")
+
+	return t.inner.DeleteOK(item)
+}
+
+// Removes the minimum item from the tree and returns it, or returns nil if the
+// tree is empty. This is equivalent to Delete(Min()), but finds the item only
+// once.
+//
+// Runs in O(log n) time.
+func (t *Tree) PopMin() Item {
+	defer t.check("PopMin")
+
+	if t.reversed {
+		return t.inner.PopMax()
+	}
+
+	return t.inner.PopMin()
+}
+
+// Removes the maximum item from the tree and returns it, or returns nil if the
+// tree is empty. This is equivalent to Delete(Max()), but finds the item only
+// once.
+//
+// Runs in O(log n) time.
+func (t *Tree) PopMax() Item {
+	defer t.check("PopMax")
+
+	if t.reversed {
+		return t.inner.PopMin()
+	}
+
+	return t.inner.PopMax()
+}
+
 // Returns an invalid Iterator pointing one past the beginning/end of
-// the tree. (it != tree.End()) implies it.IsValid().
+// the tree. !it.Equal(tree.End()) implies it.IsValid().
 func (t Tree) End() Iterator {
-	return Iterator{nil}
+	return t.iter(nil)
 }
 
-// Returns an Iterator pointing to the first item in the tree.
+// Returns an Iterator pointing to the last item in the tree, which steps
+// backwards: Next moves it to the previous item in the order of the tree, and
+// Prev to the following one. Stepping past the first item with Next makes it
+// equal to REnd, so
 //
-// Runs in O(log n) time.
+//	for it := tree.RFirst(); !it.AtEnd(); it.Next() { ... }
+//
+// visits every item in reverse order.
+//
+// Runs in O(1) time.
+func (t Tree) RFirst() Iterator {
+	it := t.Last()
+	it.reversed = !it.reversed
+	return it
+}
+
+// Returns an invalid Iterator pointing one before the first item of the tree,
+// which marks the end of a reverse iteration begun with RFirst.
+func (t Tree) REnd() Iterator {
+	it := t.End()
+	it.reversed = !it.reversed
+	return it
+}
+
+// Returns an Iterator pointing to the first item in the tree, which is the
+// item returned by Min, or End if the tree is empty. Like Min, First does not
+// descend the tree, since the tree keeps track of its minimum.
+//
+// Runs in O(1) time.
 func (t Tree) First() Iterator {
+	if t.reversed {
+		return t.iter(t.inner.max)
+	}
+
 	return t.inner.First()
 }
 
-// Returns an Iterator pointing to the last item in the tree.
+// Returns an Iterator pointing to the last item in the tree, which is the item
+// returned by Max, or End if the tree is empty.
 //
-// Runs in O(log n) time.
+// Runs in O(1) time.
 func (t Tree) Last() Iterator {
+	if t.reversed {
+		return t.iter(t.inner.min)
+	}
+
 	return t.inner.Last()
 }
 
+// Returns the smallest item in the tree which is greater than item, and true,
+// or nil and false if there is none. item need not be in the tree. Unlike
+// UpperBound, Successor ignores Flip.
+//
+// Runs in O(log n) time.
+func (t Tree) Successor(item Item) (Item, bool) {
+	if n := t.inner.successorOf(item); n != nil {
+		return n.item, true
+	}
+
+	return nil, false
+}
+
+// Returns the largest item in the tree which is less than item, and true, or
+// nil and false if there is none. item need not be in the tree. Unlike
+// LowerBound, Predecessor ignores Flip.
+//
+// Runs in O(log n) time.
+func (t Tree) Predecessor(item Item) (Item, bool) {
+	if n := t.inner.predecessorOf(item); n != nil {
+		return n.item, true
+	}
+
+	return nil, false
+}
+
 // Returns an Iterator pointing to the smallest item greater than or equal to
 // target.
 //
 // Runs in O(log n) time.
 func (t Tree) LowerBound(target Item) Iterator {
+	if t.reversed {
+		return t.iter(t.inner.floor(target))
+	}
+
 	return t.inner.LowerBound(target)
 }
 
@@ -118,5 +508,906 @@ func (t Tree) LowerBound(target Item) Iterator {
 //
 // Runs in O(log n) time.
 func (t Tree) UpperBound(target Item) Iterator {
+	if target == nil {
+		return t.End()
+	}
+
+	if t.reversed {
+		// The largest item less than target precedes the smallest item greater
+		// than or equal to it.
+		if n := t.inner.ceiling(target); n != nil {
+			return t.iter(predecessor(n))
+		}
+
+		return t.iter(t.inner.max)
+	}
+
 	return t.inner.UpperBound(target)
 }
+
+// Returns the half-open range [begin, end) of items equivalent to target, which
+// is the same as LowerBound(target), UpperBound(target), but descends the tree
+// only once. begin == end if there is no such item.
+//
+// Runs in O(log n) time.
+func (t Tree) EqualRange(target Item) (begin, end Iterator) {
+	if target == nil {
+		return t.End(), t.End()
+	}
+
+	lo, hi := t.inner.equalRange(target)
+	if t.reversed {
+		// The range runs backwards from the item before hi to the item before
+		// lo, where the item before the end of the tree is the maximum.
+		prev := func(n *node) *node {
+			if n == nil {
+				return t.inner.max
+			}
+
+			return predecessor(n)
+		}
+
+		return t.iter(prev(hi)), t.iter(prev(lo))
+	}
+
+	return t.iter(lo), t.iter(hi)
+}
+
+// Calls fn on each item in the tree in the order the tree is viewed, which is
+// ascending unless the tree has been flipped, stopping early if fn returns
+// false. The tree must not be modified by fn.
+//
+// Runs in O(n) time.
+func (t Tree) ForEach(fn func(Item) bool) {
+	forEachRange(t.First().node, nil, t.reversed, fn)
+}
+
+// Calls fn on each item in the half-open range [begin, end), in the order they
+// are visited by calling Next on begin, stopping early if fn returns false.
+// begin and end must come from this tree, and begin must not be after end. The
+// tree must not be modified by fn.
+//
+// Runs in O(m) time, where m is the number of items visited.
+func (t Tree) ForEachRange(begin, end Iterator, fn func(Item) bool) {
+	forEachRange(begin.node, end.node, begin.reversed, fn)
+}
+
+// Returns a slice containing every item in the tree in the order the tree is
+// viewed, which is ascending unless the tree has been flipped. The slice is
+// empty but not nil if the tree is empty.
+//
+// Runs in O(n) time.
+func (t Tree) ToSlice() []Item {
+	items := t.inner.ToSlice()
+	if t.reversed {
+		slices.Reverse(items)
+	}
+
+	return items
+}
+
+// Returns a slice containing the items in the half-open range [begin, end), in
+// the order they are visited by calling Next on begin. The slice is empty but
+// not nil if the range is empty. begin and end must come from this tree, and
+// begin must not be after end.
+//
+// Runs in O(log n + m) time, where m is the number of items in the range.
+func (t Tree) RangeToSlice(begin, end Iterator) []Item {
+	items := make([]Item, 0, Distance(begin, end))
+	for it := begin; !it.Equal(end); it.Next() {
+		items = append(items, it.Item())
+	}
+
+	return items
+}
+
+// Returns true if the tree contains exactly the given items in the order the
+// tree is viewed, comparing each pair with Less. Stops at the first mismatch.
+// A nil element never matches, since nil is never stored in a tree.
+//
+// Runs in O(n) time.
+func (t Tree) MatchesSlice(items []Item) bool {
+	if t.reversed {
+		items = slices.Clone(items)
+		slices.Reverse(items)
+	}
+
+	return t.inner.MatchesSlice(items)
+}
+
+// Returns the items stored in the left and right children of the node holding
+// an item equivalent to target. leftOK and rightOK report whether the
+// corresponding child exists; both are false if target is not in the tree.
+//
+// This exposes the structure of the tree, which depends on the order in which
+// items were inserted and deleted, not just on the items themselves.
+//
+// Runs in O(log n) time.
+func (t Tree) ChildrenOf(target Item) (left, right Item, leftOK, rightOK bool) {
+	if t.Empty() || target == nil {
+		return
+	}
+
+	n, ord := get(t.inner.root, target)
+	if ord != equalTo {
+		return
+	}
+
+	if n.HasLeftChild() {
+		left, leftOK = n.left.item, true
+	}
+
+	if n.HasRightChild() {
+		right, rightOK = n.right.item, true
+	}
+
+	return
+}
+
+// Checks a random sample of sampleSize root-to-leaf paths in the tree,
+// returning a descriptive error if the tree is not ordered consistently or
+// violates one of the red-black invariants. The most common cause of an error
+// is a Less method which does not define a strict weak ordering, or items
+// whose keys were modified after insertion.
+//
+// Runs in O(sampleSize * log n) time.
+func (t Tree) SelfCheck(sampleSize int) error {
+	return t.inner.selfCheck(sampleSize)
+}
+
+// Checks every node in the tree, returning a descriptive error for the first
+// violation found of the red-black invariants, of parent-pointer consistency,
+// or of the in-order sortedness of the items, or for the first pair of
+// equivalent items. Returns nil if the tree is consistent. Use this to debug
+// Item types whose Less method does not define a strict weak ordering; see
+// SelfCheck for a cheaper, sampled check.
+//
+// Items added with InsertDistinct may be equivalent under Less, so a tree
+// filled by InsertDistinct can fail this check.
+//
+// Runs in O(n) time.
+func (t Tree) DebugValidate() error {
+	if err := t.inner.validate(); err != nil {
+		return err
+	}
+
+	return t.inner.validateUnique()
+}
+
+// Returns the number of nodes on the longest path from the root of the tree to
+// a leaf, or zero if the tree is empty. The red-black invariants guarantee
+// that this is at most twice BlackHeight().
+//
+// Runs in O(n) time.
+func (t Tree) Height() int {
+	return height(t.inner.rootOrLeaf())
+}
+
+// Returns the number of black nodes on every path from the root of the tree
+// to a leaf, or zero if the tree is empty.
+//
+// Runs in O(log n) time.
+func (t Tree) BlackHeight() int {
+	return blackHeight(t.inner.rootOrLeaf())
+}
+
+// Returns a sequence of the items in the tree in the order the tree is viewed,
+// starting from the item LowerBound(start) points to. If wrap is true, the
+// sequence continues from Min after reaching Max and ends just before the item
+// it began with, so that every item is visited exactly once. If start comes
+// after every item in the tree, a wrapping sequence begins at Min and a
+// non-wrapping one is empty.
+//
+// The tree must not be modified while the sequence is being iterated.
+func (t Tree) IterateFrom(start Item, wrap bool) iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		if t.Empty() || start == nil {
+			return
+		}
+
+		first := t.LowerBound(start).node
+		if first == nil {
+			if !wrap {
+				return
+			}
+
+			first = t.First().node
+		}
+
+		next := successor
+		if t.reversed {
+			next = predecessor
+		}
+
+		for n := first; n != nil; n = next(n) {
+			if !yield(n.item) {
+				return
+			}
+		}
+
+		if !wrap {
+			return
+		}
+
+		for n := t.First().node; n != first; n = next(n) {
+			if !yield(n.item) {
+				return
+			}
+		}
+	}
+}
+
+// Searches the tree exactly as Find does, but also returns the number of calls
+// to Less made during the search. This is intended for diagnosing expensive
+// comparisons on deep paths; use Find or FindItem for normal lookups.
+//
+// Runs in O(log n) time.
+func (t Tree) Probe(item Item) (found bool, comparisons int) {
+	if t.Empty() || item == nil {
+		return false, 0
+	}
+
+	// This mirrors get, counting each comparison as it is made.
+	for n := t.inner.root; n != nilChild; {
+		comparisons += 1
+		if item.Less(n.item) {
+			n = n.left
+			continue
+		}
+
+		comparisons += 1
+		if n.item.Less(item) {
+			n = n.right
+			continue
+		}
+
+		return true, comparisons
+	}
+
+	return false, comparisons
+}
+
+// Returns a MultiValuedTree containing the same items as this tree. The two
+// trees share their nodes, so Iterators into the original tree remain valid
+// and can be used with the new one. Since they share nodes, only one of the
+// two trees should be used after the conversion; modifying either one leaves
+// the other in an inconsistent state.
+//
+// Runs in O(1) time.
+func (t Tree) AsMultiValued() MultiValuedTree {
+	return MultiValuedTree{inner: t.inner}
+}
+
+// Returns the result of calling lerp on the largest item less than or equal to
+// lo and the smallest item greater than or equal to hi, or nil if either does
+// not exist. This is useful for estimating a value between two sampled points,
+// where lerp interpolates between the samples a and b at fraction f.
+//
+// Runs in O(log n) time.
+func (t Tree) Interpolate(lo, hi Item, frac float64, lerp func(a, b Item, f float64) Item) Item {
+	a, b := t.inner.floor(lo), t.inner.ceiling(hi)
+	if a == nil || b == nil {
+		return nil
+	}
+
+	return lerp(a.item, b.item, frac)
+}
+
+// Splits the tree into two trees, the first containing the k smallest items and
+// the second containing the rest, both viewed in the same order as the
+// receiver. In a flipped tree, the first contains the k largest items, so that
+// it holds the first k items in the order the tree is viewed, as with Select.
+// k is clamped to the range [0, Size()]. The receiver is left empty.
+//
+// Runs in O(log² n) time.
+func (t *Tree) SplitAtRank(k int) (left, right Tree) {
+	if k < 0 {
+		k = 0
+	} else if k > t.Size() {
+		k = t.Size()
+	}
+
+	i := k
+	if t.reversed {
+		i = t.Size() - k
+	}
+
+	smaller, larger := t.inner, tree{pooled: t.inner.pooled, monoid: t.inner.monoid}
+	if n := t.inner.selectNode(i); n != nil {
+		smaller, larger = t.inner.split(n.item)
+	} else if i == 0 {
+		smaller, larger = larger, smaller
+	}
+
+	left, right = *t, *t
+	left.inner, right.inner = smaller, larger
+	if t.reversed {
+		left.inner, right.inner = larger, smaller
+	}
+
+	left.check("SplitAtRank")
+	right.check("SplitAtRank")
+	t.Clear()
+	return
+}
+
+// Inserts every one of items which does not have an equivalent in the tree,
+// returning the number of items inserted. The items should be sorted in
+// ascending order, and may fall anywhere in the tree, between its existing
+// items as well as after its maximum. Rather than searching from the root for
+// each item, InsertSorted steps forward through the tree from the previous
+// item and links the new one as with InsertHint. An item which is out of order
+// is simply inserted as with Insert.
+//
+// Runs in O(k log n + m) time, where k is the number of items and m is the
+// number of items of the tree between the first and last of them.
+func (t *Tree) InsertSorted(items []Item) int {
+	defer t.check("InsertSorted")
+
+	return t.inner.insertSorted(items)
+}
+
+// Inserts every item of other which does not have an equivalent in the tree,
+// returning the number of items inserted. other is not modified, and the two
+// trees share no nodes afterwards.
+//
+// If the items of other are all less than or all greater than those of the
+// tree, a copy of other is joined to the tree as in Merge. Otherwise, InsertAll
+// walks both trees in step and links each new item next to its successor, as
+// with InsertHint.
+//
+// Runs in O(m + log n) time if the trees do not overlap, or O(n + m log n) time
+// otherwise, where m is the size of other.
+func (t *Tree) InsertAll(other Tree) int {
+	defer t.check("InsertAll")
+
+	return t.inner.insertAll(other.inner)
+}
+
+// Deletes every item for which pred returns true, returning the number of
+// items deleted. The items are visited once each in ascending order, and each
+// one is deleted without searching for it, as with DeleteIterator. pred must
+// not modify the tree.
+//
+// Runs in O(n + m log n) time, where m is the number of items deleted.
+func (t *Tree) RemoveIf(pred func(Item) bool) int {
+	defer t.check("RemoveIf")
+
+	return t.inner.removeIf(pred)
+}
+
+// Same as RemoveIf, but deletes every item for which pred returns false,
+// keeping only those for which it returns true.
+//
+// Runs in O(n + m log n) time, where m is the number of items deleted.
+func (t *Tree) RetainIf(pred func(Item) bool) int {
+	defer t.check("RetainIf")
+
+	return t.inner.removeIf(func(item Item) bool { return !pred(item) })
+}
+
+// Deletes every item greater than or equal to lo and less than hi, returning
+// the number of items deleted. Rather than deleting the items one by one,
+// DeleteRange splits the range out of the tree and merges the pieces on either
+// side of it, as in Split and Merge.
+//
+// Runs in O(log² n) time.
+func (t *Tree) DeleteRange(lo, hi Item) int {
+	defer t.check("DeleteRange")
+
+	return t.inner.deleteRange(lo, hi)
+}
+
+// Splits the tree into a tree of the items less than item and a tree of the
+// rest, both viewed in the same order as the receiver, which is left empty.
+// Rather than inserting the items into new trees, Split cuts the tree along
+// the path to item and joins the pieces on either side of it as in Merge.
+//
+// Runs in O(log² n) time.
+func (t *Tree) Split(item Item) (less, greaterOrEqual Tree) {
+	less, greaterOrEqual = *t, *t
+	if item == nil {
+		// Nothing is cut off, so every item stays in less.
+		greaterOrEqual.inner = tree{pooled: t.inner.pooled, monoid: t.inner.monoid}
+	} else {
+		less.inner, greaterOrEqual.inner = t.inner.split(item)
+	}
+	less.check("Split")
+	greaterOrEqual.check("Split")
+	t.Clear()
+	return
+}
+
+// Returns a deep copy of the tree which shares no nodes with the original, so
+// either one can be modified without affecting the other. The copy has the
+// same shape as the original and is viewed in the same order. The items
+// themselves are not copied.
+//
+// Runs in O(n) time.
+func (t Tree) Clone() Tree {
+	c := t
+	c.inner = t.inner.clone()
+	return c
+}
+
+// Reverses the order in which the tree is viewed. After a call to Flip, Min
+// returns the maximum item, First points to the last item, Iterators step
+// towards smaller items when advanced with Next, and LowerBound and UpperBound
+// search in descending order. Calling Flip again restores the original order.
+//
+// The nodes of the tree are not modified; they stay sorted by Less and are
+// simply interpreted in reverse. Besides the methods above, PopMin, PopMax,
+// Find, End, EqualRange, ForEach, ToSlice, MatchesSlice, IterateFrom, Select,
+// Rank, IndexRange, PercentileRange, SplitAtRank, KeyAtCumulativeWeight,
+// Window, RangeIterator and the Iterators they return follow the reversed
+// order.
+//
+// Runs in O(1) time.
+func (t *Tree) Flip() {
+	t.reversed = !t.reversed
+}
+
+// Returns an Iterator pointing to n which steps in the direction the tree is
+// currently viewed.
+func (t Tree) iter(n *node) Iterator {
+	return Iterator{node: n, root: t.inner.root, reversed: t.reversed}
+}
+
+// Deletes all but the n largest items in the tree, returning the number of
+// items which were deleted. This is useful as a retention policy for trees of
+// items keyed by timestamp.
+//
+// Runs in the same time as SplitAtRank.
+func (t *Tree) KeepNewest(n int) int {
+	defer t.check("KeepNewest")
+
+	if n < 0 {
+		n = 0
+	}
+
+	removed := t.Size() - n
+	if removed <= 0 {
+		return 0
+	}
+
+	// The largest items come first in a flipped tree.
+	var newest Tree
+	if t.reversed {
+		newest, _ = t.SplitAtRank(n)
+	} else {
+		_, newest = t.SplitAtRank(removed)
+	}
+
+	t.inner = newest.inner
+	return removed
+}
+
+// Returns the first item and length of the longest run of items in which each
+// item is equal to next applied to the item before it, such as a stretch of
+// consecutive integers. If several runs have the same length, the smallest is
+// returned. Returns nil and zero if the tree is empty.
+//
+// Runs in O(n) time.
+func (t Tree) LongestConsecutiveRun(next func(Item) Item, equal func(a, b Item) bool) (start Item, length int) {
+	var runStart, prev *node
+	runLength := 0
+
+	for n := t.inner.First().node; n != nil; prev, n = n, successor(n) {
+		if prev != nil && equal(next(prev.item), n.item) {
+			runLength += 1
+		} else {
+			runStart, runLength = n, 1
+		}
+
+		if runLength > length {
+			start, length = runStart.item, runLength
+		}
+	}
+
+	return
+}
+
+// Merges the items in the tree with the sorted items received from in,
+// sending the combined sequence to out in order and closing out once both
+// are exhausted. When an item from in is equivalent to one in the tree, the
+// item from the tree is sent first. Neither side is buffered.
+//
+// The tree must not be modified until MergeChannel returns.
+func (t Tree) MergeChannel(in <-chan Item, out chan<- Item) {
+	defer close(out)
+
+	n := t.inner.First().node
+	for item := range in {
+		if item == nil {
+			continue
+		}
+
+		for n != nil && !item.Less(n.item) {
+			out <- n.item
+			n = successor(n)
+		}
+
+		out <- item
+	}
+
+	for ; n != nil; n = successor(n) {
+		out <- n.item
+	}
+}
+
+// Returns the items in a tree of Ints which lie on the grid origin + k*step
+// for some k >= 0, in order. Gaps in the tree are skipped, so this takes time
+// proportional to the number of items near the grid rather than the number of
+// grid points. step must be positive.
+//
+// Runs in O(m log n) time, where m is the number of items examined.
+func (t Tree) OnGrid(origin, step Int) []Int {
+	if step <= 0 {
+		return nil
+	}
+
+	var items []Int
+	for x := origin; ; {
+		n := t.inner.ceiling(x)
+		if n == nil {
+			break
+		}
+
+		item := n.item.(Int)
+		offset := (item - origin) % step
+		if offset == 0 {
+			items = append(items, item)
+		}
+
+		// Skip to the next grid point after item, unless it would overflow.
+		if step-offset > math.MaxInt-item {
+			break
+		}
+		x = item + step - offset
+	}
+
+	return items
+}
+
+// Returns the half-open range of in-order indices [begin, end) occupied by
+// the items greater than or equal to lo and less than hi. If the items of the
+// tree are copied into a slice in order, slice[begin:end] holds exactly those
+// items, and end - begin counts them without visiting them. If hi is not
+// greater than lo, begin == end. In a flipped tree, the indices count in
+// descending order, as with Rank, and the range holds the items less than or
+// equal to lo and greater than hi.
+//
+// Runs in O(log n) time.
+func (t Tree) IndexRange(lo, hi Item) (begin, end int) {
+	if lo == nil || hi == nil {
+		return 0, 0
+	}
+
+	begin, end = t.Rank(lo), t.Rank(hi)
+	if end < begin {
+		end = begin
+	}
+
+	return
+}
+
+// Returns the kth smallest item in the tree, counting from zero, along with
+// true. Returns false if k is negative or not less than Size(). In a flipped
+// tree, this is the kth largest item, so that Select(0) is Min.
+//
+// Runs in O(log n) time.
+func (t Tree) Select(k int) (Item, bool) {
+	if t.reversed && k >= 0 {
+		k = t.Size() - 1 - k
+	}
+
+	if n := t.inner.selectNode(k); n != nil {
+		return n.item, true
+	}
+
+	return nil, false
+}
+
+// Returns the number of items in the tree which are less than item, or
+// greater than item if the tree has been flipped, so that Select(Rank(item))
+// is item. item itself need not be in the tree.
+//
+// Runs in O(log n) time.
+func (t Tree) Rank(item Item) int {
+	if item == nil {
+		return 0
+	}
+
+	if t.reversed {
+		return t.Size() - t.inner.rank(item) - t.inner.count(item)
+	}
+
+	return t.inner.rank(item)
+}
+
+// Panics if the tree is checked and no longer valid after the named operation.
+func (t *Tree) check(op string) {
+	if !t.checked {
+		return
+	}
+
+	if err := t.inner.validate(); err != nil {
+		panic(fmt.Sprintf("rbtree: %s corrupted the tree: %v", op, err))
+	}
+}
+
+// Panics if the tree is checked and item is inconsistently ordered against the
+// items an insertion of it would compare it with. See NewChecked.
+func (t *Tree) checkLess(op string, item Item) {
+	if !t.checked {
+		return
+	}
+
+	if err := t.inner.checkComparisons(item); err != nil {
+		panic(fmt.Sprintf("rbtree: %s: %v", op, err))
+	}
+}
+
+// Returns the items of the tree grouped by the key returned by keyOf. The
+// items in each group are in sorted order.
+//
+// Runs in O(n) time.
+func (t Tree) GroupBy(keyOf func(Item) interface{}) map[interface{}][]Item {
+	groups := make(map[interface{}][]Item)
+	for n := t.inner.First().node; n != nil; n = successor(n) {
+		key := keyOf(n.item)
+		groups[key] = append(groups[key], n.item)
+	}
+
+	return groups
+}
+
+// Returns Iterators delimiting the items between the loPct and hiPct
+// percentiles of the tree by rank, where percentiles are fractions in [0, 1].
+// The range begins at the item with rank floor(loPct * Size()) and ends before
+// the item with rank floor(hiPct * Size()). Percentiles outside [0, 1] are
+// clamped, and begin == end if hiPct is not greater than loPct. In a flipped
+// tree, ranks count in descending order, as with Select.
+//
+// Runs in O(log n) time.
+func (t Tree) PercentileRange(loPct, hiPct float64) (begin, end Iterator) {
+	clamp := func(pct float64) int {
+		switch {
+		case pct < 0:
+			return 0
+		case pct > 1:
+			return t.Size()
+		default:
+			return int(pct * float64(t.Size()))
+		}
+	}
+
+	lo, hi := clamp(loPct), clamp(hiPct)
+	if hi < lo {
+		hi = lo
+	}
+
+	if t.reversed {
+		lo, hi = t.Size()-1-lo, t.Size()-1-hi
+	}
+
+	return t.iter(t.inner.selectNode(lo)), t.iter(t.inner.selectNode(hi))
+}
+
+// Returns the first item for which the cumulative weight of all the items
+// before it exceeds w, along with true. Returns false if there is no such item,
+// because the weight of every item but the last does not exceed w. This
+// generalizes selecting the kth item to weighted items, and can be used to find
+// weighted medians and quantiles. In a flipped tree, the items before an item
+// are those greater than it.
+//
+// The weights are those of the function passed to NewWeighted, and must not be
+// negative. KeyAtCumulativeWeight panics if the tree was not created by
+// NewWeighted.
+//
+// Runs in O(log n) time, using the subtree sums to descend from the root as
+// Select does.
+func (t Tree) KeyAtCumulativeWeight(w float64) (Item, bool) {
+	m := t.inner.monoid
+	if m == nil || m.weight == nil {
+		panic("rbtree: KeyAtCumulativeWeight of a tree without weights")
+	}
+
+	var found *node
+	for n := t.inner.rootOrLeaf(); n != nilChild; {
+		near, far := n.left, n.right
+		if t.reversed {
+			near, far = far, near
+		}
+
+		if before := m.of(near).(float64); w < before {
+			found, n = n, near
+		} else {
+			w -= before + m.weight(n.item)
+			n = far
+		}
+	}
+
+	if found == nil {
+		return nil, false
+	}
+
+	return found.item, true
+}
+
+// Inserts an item representing an interval, first coalescing it with any
+// neighbouring items for which overlaps returns true. Each overlapping
+// neighbour is deleted and combined with the new item using merge, and the
+// search repeats from the combined item, so that a single insertion can absorb
+// any number of neighbours. If the item still has an equivalent in the tree
+// afterwards, the equivalent is replaced.
+//
+// This keeps a set of intervals ordered by their start normalized, so that no
+// two items overlap. overlaps and merge are always passed the smaller item
+// first.
+//
+// Runs in O((k+1) log n) time, where k is the number of items merged.
+func (t *Tree) InsertInterval(item Item, overlaps func(a, b Item) bool, merge func(a, b Item) Item) {
+	defer t.check("InsertInterval")
+
+	if item == nil {
+		return
+	}
+
+	for {
+		if p := t.inner.floor(item); p != nil && overlaps(p.item, item) {
+			item = merge(t.inner.remove(p), item)
+		} else if s := t.inner.ceiling(item); s != nil && overlaps(item, s.item) {
+			item = merge(item, t.inner.remove(s))
+		} else {
+			break
+		}
+	}
+
+	t.inner.InsertOrReplace(item)
+}
+
+// Returns the items whose score is strictly greater than the scores of their
+// in-order neighbours, in order. The first and last items only have one
+// neighbour to compare against, and the only item of a single-item tree is
+// always a peak.
+//
+// Runs in O(n) time, calling score once per item.
+func (t Tree) Peaks(score func(Item) float64) []Item {
+	var peaks []Item
+	if t.Empty() {
+		return peaks
+	}
+
+	// Slide a window of three consecutive items across the tree.
+	n := t.inner.min
+	s := score(n.item)
+	hasPrev, prevScore := false, 0.0
+	for n != nil {
+		next := successor(n)
+		nextScore := 0.0
+		if next != nil {
+			nextScore = score(next.item)
+		}
+
+		if (!hasPrev || s > prevScore) && (next == nil || s > nextScore) {
+			peaks = append(peaks, n.item)
+		}
+
+		hasPrev, prevScore = true, s
+		n, s = next, nextScore
+	}
+
+	return peaks
+}
+
+// Returns up to before items less than target, followed by up to after items
+// greater than or equal to target, in order. The window is truncated at the
+// ends of the tree. In a flipped tree, the window is in descending order and
+// centered on LowerBound(target), so the items before it are greater than
+// target.
+//
+// Runs in O(log n + before + after) time.
+func (t Tree) Window(target Item, before, after int) []Item {
+	if t.Empty() || target == nil {
+		return nil
+	}
+
+	center := t.LowerBound(target)
+
+	// Walk backwards from the center to find the start of the window. Prev
+	// steps from End to the last item.
+	start := center
+	for i := 0; i < before; i++ {
+		prev := start
+		if prev.Prev(); prev.AtEnd() {
+			break
+		}
+		start = prev
+	}
+
+	var items []Item
+	it := start
+	for ; !it.Equal(center); it.Next() {
+		items = append(items, it.Item())
+	}
+
+	for i := 0; i < after && !it.AtEnd(); i++ {
+		items = append(items, it.Item())
+		it.Next()
+	}
+
+	return items
+}
+
+// Replaces every item for which pred returns true with replace(item), in
+// place, returning the number of items replaced. The replacement must be
+// equivalent to the item it replaces, since the tree is not reordered; this is
+// intended for updating the payloads of items without searching for each one.
+// Trees created with NewChecked verify the order afterwards.
+//
+// Runs in O(n) time.
+func (t *Tree) ReplaceFunc(pred func(Item) bool, replace func(Item) Item) int {
+	defer t.check("ReplaceFunc")
+
+	count := 0
+	for n := t.inner.First().node; n != nil; n = successor(n) {
+		if pred(n.item) {
+			n.item = replace(n.item)
+			updateAggregatesFrom(n)
+			count += 1
+		}
+	}
+
+	return count
+}
+
+// Slides a window of keys [start, start+windowSize) across the tree in steps
+// of step, beginning with start equal to the key of the minimum item and
+// ending with the last window which starts at or before the key of the maximum
+// item. For each window position, returns the result of combining the items
+// in the window in order with add, or nil if the window contains no items.
+// toKey must return keys which are ordered consistently with Less, and step and
+// windowSize must be positive.
+//
+// Runs in O(w log n + n * windowSize / step) time, where w is the number of
+// windows.
+func (t Tree) SlidingAggregate(windowSize Int, step Int, add func(a, b Item) Item, toKey func(Item) Int) []Item {
+	if t.Empty() || windowSize <= 0 || step <= 0 {
+		return nil
+	}
+
+	var aggregates []Item
+	for start, last := toKey(t.inner.min.item), toKey(t.inner.max.item); start <= last; start += step {
+		first := t.inner.lowerBoundKey(start, toKey)
+		end := t.inner.lowerBoundKey(start+windowSize, toKey)
+
+		var aggregate Item
+		for n := first; n != end; n = successor(n) {
+			if aggregate == nil {
+				aggregate = n.item
+			} else {
+				aggregate = add(aggregate, n.item)
+			}
+		}
+
+		aggregates = append(aggregates, aggregate)
+	}
+
+	return aggregates
+}
+
+// Returns the first node whose key is not less than key, or nil if there is
+// none. This is LowerBound for a tree searched by the keys which toKey assigns
+// to its items.
+func (t tree) lowerBoundKey(key Int, toKey func(Item) Int) (bound *node) {
+	for n := t.root; n != nilChild; {
+		if toKey(n.item) < key {
+			n = n.right
+		} else {
+			bound, n = n, n.left
+		}
+	}
+
+	return
+}
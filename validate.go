@@ -0,0 +1,222 @@
+package rbtree
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Checks a random sample of root-to-leaf paths in the tree, returning an error
+// describing the first inconsistency found.
+//
+// Along each path we check that parent pointers are consistent, that no red
+// node has a red child, and that every item lies between the bounds imposed by
+// its ancestors. Every leaf reached must also have the same number of black
+// ancestors.
+func (t tree) selfCheck(samples int) error {
+	if t.Empty() {
+		if t.size != 0 {
+			return fmt.Errorf("rbtree: empty tree has size %d", t.size)
+		}
+
+		return nil
+	}
+
+	if t.root.IsRed() {
+		return fmt.Errorf("rbtree: root node is red")
+	}
+
+	if !t.root.IsRoot() {
+		return fmt.Errorf("rbtree: root node has a parent")
+	}
+
+	blackHeight := -1
+	for i := 0; i < samples; i++ {
+		var lo, hi Item
+		blacks := 0
+
+		for n := t.root; ; {
+			if lo != nil && n.item.Less(lo) || hi != nil && hi.Less(n.item) {
+				return fmt.Errorf("rbtree: item %v is out of order", n.item)
+			}
+
+			if n.IsBlack() {
+				blacks += 1
+			}
+
+			children := n.Children()
+			for _, child := range children {
+				if child == nilChild {
+					continue
+				}
+
+				if child.Parent() != n {
+					return fmt.Errorf("rbtree: invalid parent pointer below item %v", n.item)
+				}
+
+				if n.IsRed() && child.IsRed() {
+					return fmt.Errorf("rbtree: red item %v has a red child", n.item)
+				}
+			}
+
+			dir := rand.Intn(2)
+			if children[dir] == nilChild {
+				break
+			}
+
+			if dir == 0 {
+				hi = n.item
+			} else {
+				lo = n.item
+			}
+
+			n = children[dir]
+		}
+
+		if blackHeight == -1 {
+			blackHeight = blacks
+		} else if blacks != blackHeight {
+			return fmt.Errorf("rbtree: paths contain %d and %d black nodes", blackHeight, blacks)
+		}
+	}
+
+	return nil
+}
+
+// Returns an error describing the first pair of adjacent items in the tree
+// which are equivalent, or nil if every item is unique. The tree must be
+// ordered.
+func (t tree) validateUnique() error {
+	for n := t.First().node; n != nil; n = successor(n) {
+		if next := successor(n); next != nil && !n.item.Less(next.item) {
+			return fmt.Errorf("rbtree: items %v and %v are equivalent", n.item, next.item)
+		}
+	}
+
+	return nil
+}
+
+// Checks every node in the tree, returning an error describing the first
+// violation of the red-black invariants, of the ordering defined by Less, or
+// of the bookkeeping kept by tree.
+func (t tree) validate() error {
+	if t.Empty() {
+		if t.size != 0 {
+			return fmt.Errorf("rbtree: empty tree has size %d", t.size)
+		}
+
+		return nil
+	}
+
+	if t.root.IsRed() {
+		return fmt.Errorf("rbtree: root node is red")
+	}
+
+	if !t.root.IsRoot() {
+		return fmt.Errorf("rbtree: root node has a parent")
+	}
+
+	if t.min != min(t.root) || t.max != max(t.root) {
+		return fmt.Errorf("rbtree: cached minimum or maximum is out of date")
+	}
+
+	var prev *node
+	count := 0
+	if _, err := validateSubtree(t.root, &prev, &count); err != nil {
+		return err
+	}
+
+	if count != t.size {
+		return fmt.Errorf("rbtree: tree has size %d but contains %d items", t.size, count)
+	}
+
+	return nil
+}
+
+// Validates the subtree rooted at n, returning its black height. prev holds the
+// node visited before n in an in-order traversal, and count the number of
+// nodes visited so far.
+func validateSubtree(n *node, prev **node, count *int) (int, error) {
+	if n == nilChild {
+		if n.size != 0 {
+			return 0, fmt.Errorf("rbtree: nilChild has size %d", n.size)
+		}
+
+		return 0, nil
+	}
+
+	for _, child := range n.Children() {
+		if child == nilChild {
+			continue
+		}
+
+		if child.Parent() != n {
+			return 0, fmt.Errorf("rbtree: invalid parent pointer below item %v", n.item)
+		}
+
+		if n.IsRed() && child.IsRed() {
+			return 0, fmt.Errorf("rbtree: red item %v has a red child", n.item)
+		}
+	}
+
+	left, err := validateSubtree(n.left, prev, count)
+	if err != nil {
+		return 0, err
+	}
+
+	if *prev != nil && n.item.Less((*prev).item) {
+		return 0, fmt.Errorf("rbtree: item %v is out of order after %v", n.item, (*prev).item)
+	}
+
+	*prev = n
+	*count += 1
+
+	right, err := validateSubtree(n.right, prev, count)
+	if err != nil {
+		return 0, err
+	}
+
+	if left != right {
+		return 0, fmt.Errorf("rbtree: paths below item %v contain %d and %d black nodes", n.item, left, right)
+	}
+
+	if n.size != n.left.size+n.right.size+1 {
+		return 0, fmt.Errorf("rbtree: subtree of item %v has size %d but contains %d items", n.item, n.size, n.left.size+n.right.size+1)
+	}
+
+	if n.IsBlack() {
+		left += 1
+	}
+
+	return left, nil
+}
+
+// Compares item in both directions with itself and with every item on its
+// search path from the root, returning an error describing the first pair of
+// items which are each less than the other. These are the comparisons an
+// insertion of item performs, so a tree whose Less is inconsistent for them
+// would be silently corrupted by the insertion.
+func (t tree) checkComparisons(item Item) error {
+	if item == nil {
+		return nil
+	}
+
+	if item.Less(item) {
+		return fmt.Errorf("rbtree: inconsistent Less: item %v is less than itself", item)
+	}
+
+	for n := t.root; n != nil && n != nilChild; {
+		less, greater := item.Less(n.item), n.item.Less(item)
+		switch {
+		case less && greater:
+			return fmt.Errorf("rbtree: inconsistent Less: items %v and %v are each less than the other", item, n.item)
+		case less:
+			n = n.left
+		case greater:
+			n = n.right
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package rbtree
+
+// A read-only view of the items in a tree as if they were a sorted slice. A
+// SortedView reads directly from the tree without copying it, so it must not
+// be used after the tree is modified.
+type SortedView struct {
+	inner tree
+}
+
+// Returns a read-only, slice-like view of the items in the tree.
+func (t Tree) View() SortedView {
+	return SortedView{t.inner}
+}
+
+// Returns the number of items in the view.
+func (v SortedView) Len() int {
+	return v.inner.Size()
+}
+
+// Returns the ith smallest item in the view, counting from zero. At panics if
+// i is out of range.
+//
+// Runs in O(log n) time.
+func (v SortedView) At(i int) Item {
+	n := v.inner.selectNode(i)
+	if n == nil {
+		panic("rbtree: SortedView index out of range")
+	}
+
+	return n.item
+}
+
+// Returns the index of an item equivalent to target, along with true, if one
+// exists. Otherwise, returns the index at which target would be inserted and
+// false.
+//
+// Runs in O(log n) time.
+func (v SortedView) Find(target Item) (int, bool) {
+	if target == nil {
+		return 0, false
+	}
+
+	i := v.inner.rank(target)
+	n := v.inner.selectNode(i)
+	return i, n != nil && !target.Less(n.item)
+}